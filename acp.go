@@ -11,8 +11,21 @@ type Copyer struct {
 	*option
 	running           sync.WaitGroup
 	eventCh           chan Event
-	getDevice         func(in string) string
+	mountLock         sync.RWMutex
+	mountPoints       func(in string) string
 	getDiskUsageCache func(mountPoint string) *diskUsageCache
+	tmpCleaner        func(dir string) *sync.Once
+	fromLimiter       *bandwidthLimiter
+	toLimiter         *bandwidthLimiter
+	// limiters of devices set by SetTargetDevice, by the cleaned mount point
+	deviceLimiters map[string]*bandwidthLimiter
+	ctrl           control
+	media          mediaChange
+
+	// dirs walked from wildcard jobs, in walk order, parents are before children
+	dirs []*dirJob
+	// space planned on each target device, only used in dry run
+	planDevices map[string]*PlanDevice
 }
 
 func New(ctx context.Context, opts ...Option) (*Copyer, error) {
@@ -27,22 +40,35 @@ func New(ctx context.Context, opts ...Option) (*Copyer, error) {
 		return nil, err
 	}
 
-	getDevice, err := getMountpointCache()
+	mountPoints, err := getMountpointCache()
 	if err != nil {
 		return nil, err
 	}
 
 	c := &Copyer{
-		option:    opt,
-		eventCh:   make(chan Event, 128),
-		getDevice: getDevice,
+		option:      opt,
+		eventCh:     make(chan Event, 128),
+		mountPoints: mountPoints,
 		getDiskUsageCache: Cache(func(mountPoint string) *diskUsageCache {
 			return newDiskUsageCache(mountPoint, defaultDiskUsageFreshInterval)
 		}),
+		tmpCleaner:  Cache(func(dir string) *sync.Once { return new(sync.Once) }),
+		fromLimiter: newBandwidthLimiter(opt.fromDevice.bandwidth),
+		toLimiter:   newBandwidthLimiter(opt.toDevice.bandwidth),
 	}
+	c.deviceLimiters = make(map[string]*bandwidthLimiter, len(opt.targetDeviceOpts))
+	for mountPoint, do := range opt.targetDeviceOpts {
+		c.deviceLimiters[mountPoint] = newBandwidthLimiter(do.bandwidth)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	c.ctrl.cancel = cancel
 
 	c.running.Add(1)
-	go wrap(ctx, func() { c.run(ctx) })
+	go wrap(ctx, func() {
+		defer cancel()
+		c.run(ctx)
+	})
 
 	return c, nil
 }
@@ -57,16 +83,42 @@ func (c *Copyer) run(ctx context.Context) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	c.running.Add(1)
 	go wrap(ctx, func() { c.eventLoop(ctx) })
 
 	indexed, err := c.index(ctx)
 	if err != nil {
+		c.closeEvents()
 		return err
 	}
 
+	if c.dryRun {
+		c.plan(ctx, indexed)
+		for range indexed {
+		}
+
+		c.closeEvents()
+		return nil
+	}
+
+	if c.archive != nil {
+		if err := c.archive.open(); err != nil {
+			c.reportError("", c.archive.name, err)
+
+			cancel()
+			for range indexed {
+			}
+			c.closeEvents()
+			return err
+		}
+	}
+
 	prepared := c.prepare(ctx, indexed)
 	copyed := c.copy(ctx, prepared)
-	c.cleanupJob(ctx, copyed)
+	verified := c.verify(ctx, copyed)
+	c.cleanupJob(ctx, verified)
+	c.cleanupDirs(ctx)
+	c.closeArchive()
 
 	// empty pipes
 	for range indexed {
@@ -75,12 +127,15 @@ func (c *Copyer) run(ctx context.Context) error {
 	}
 	for range copyed {
 	}
+	for range verified {
+	}
 
+	// all stages are stopped, no more event will be submitted
+	c.closeEvents()
 	return nil
 }
 
 func (c *Copyer) eventLoop(ctx context.Context) {
-	c.running.Add(1)
 	defer c.running.Done()
 
 	chans := make([]chan Event, len(c.eventHanders))
@@ -112,17 +167,9 @@ func (c *Copyer) eventLoop(ctx context.Context) {
 			close(ch)
 		}
 	}()
-	for {
-		select {
-		case e, ok := <-c.eventCh:
-			if !ok {
-				return
-			}
-			for _, ch := range chans {
-				ch <- e
-			}
-		case <-ctx.Done():
-			return
+	for e := range c.eventCh {
+		for _, ch := range chans {
+			ch <- e
 		}
 	}
 }
@@ -0,0 +1,354 @@
+package acp
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// ArchiveMember is the position of a job in the archive target.
+type ArchiveMember struct {
+	Name string `json:"name"`
+	// Offset is the offset of the member header in archive, a tar reader can start from it.
+	Offset int64 `json:"offset"`
+	// File is the file number of the archive on tape, only set by tape target.
+	File int `json:"file,omitempty"`
+	// Block is the block of the member header in the tape file, only set by tape target.
+	// The header starts at `Offset % block size` of the block.
+	Block int64 `json:"block,omitempty"`
+}
+
+type archiveTarget struct {
+	name   string
+	path   string
+	closer io.Closer
+
+	// tape is set by tape target, archives are split by filemarks
+	tape      *tapeOption
+	tapeFile  *tapeWriter
+	tapeIndex int
+
+	counter *countWriter
+	tw      *tar.Writer
+
+	dirs    map[string]*stat
+	written map[string]struct{}
+	members map[*baseJob]string
+
+	// err is set when the archive is broken, then no more member can be written
+	err error
+}
+
+type countWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	return n, err
+}
+
+func newArchiveTarget(name string, w io.Writer) *archiveTarget {
+	counter := &countWriter{w: w}
+	return &archiveTarget{
+		name:    name,
+		counter: counter,
+		tw:      tar.NewWriter(counter),
+		written: make(map[string]struct{}, 64),
+		members: make(map[*baseJob]string, 64),
+	}
+}
+
+// WithTarTarget write all jobs into w as a pax archive, in the sorted order of jobs, besides targets.
+// Threads of devices are set to 1 to keep the order. Offset of each member is reported in `Job.Archive`.
+func WithTarTarget(w io.Writer) Option {
+	return func(o *option) *option {
+		o.archive = newArchiveTarget("tar", w)
+		return o
+	}
+}
+
+// WithTarTargetFile write all jobs into a pax archive file at path, see `WithTarTarget`.
+func WithTarTargetFile(path string) Option {
+	return func(o *option) *option {
+		o.archive = &archiveTarget{name: path, path: path}
+		return o
+	}
+}
+
+func (a *archiveTarget) check() error {
+	if a.tape != nil {
+		return a.tape.check()
+	}
+	return nil
+}
+
+// open creates the archive file or opens the tape at path, it is called after dry run is checked,
+// so targets are never touched by dry run.
+func (a *archiveTarget) open() error {
+	if a.path == "" || a.tw != nil {
+		return nil
+	}
+	if a.tape != nil {
+		w, err := openTapeWriter(a.path, a.tape)
+		if err != nil {
+			return err
+		}
+
+		opened := newArchiveTarget(a.name, w)
+		opened.closer, opened.tape, opened.tapeFile, opened.tapeIndex = w, a.tape, w, a.tape.fileNumber
+		*a = *opened
+		return nil
+	}
+
+	file, err := os.Create(a.path)
+	if err != nil {
+		return fmt.Errorf("create archive file fail, path= '%s', %w", a.path, err)
+	}
+
+	opened := newArchiveTarget(a.name, file)
+	opened.closer = file
+	*a = *opened
+	return nil
+}
+
+func archiveName(job *baseJob) string {
+	return strings.TrimPrefix(job.src.path, "/")
+}
+
+func (c *Copyer) archiveHeader(job *baseJob, size int64) (*tar.Header, error) {
+	st := job.stat
+	hdr := &tar.Header{
+		Name:    archiveName(job),
+		Mode:    int64(st.mode.Perm()),
+		ModTime: st.modTime,
+		Format:  tar.FormatPAX,
+	}
+	if st.mode&fs.ModeSetuid != 0 {
+		hdr.Mode |= 0o4000
+	}
+	if st.mode&fs.ModeSetgid != 0 {
+		hdr.Mode |= 0o2000
+	}
+	if st.mode&fs.ModeSticky != 0 {
+		hdr.Mode |= 0o1000
+	}
+
+	switch {
+	case job.linkTo != nil:
+		linkname, has := c.archive.members[job.linkTo]
+		if !has {
+			return nil, fmt.Errorf("hard link source is not archived, '%s'", job.linkTo.path)
+		}
+		hdr.Typeflag, hdr.Linkname = tar.TypeLink, linkname
+	case st.mode.IsRegular():
+		hdr.Typeflag, hdr.Size = tar.TypeReg, size
+	case st.mode.IsDir():
+		hdr.Typeflag, hdr.Name = tar.TypeDir, hdr.Name+"/"
+	case st.mode&fs.ModeSymlink != 0:
+		hdr.Typeflag, hdr.Linkname = tar.TypeSymlink, st.link
+	case st.mode&fs.ModeNamedPipe != 0:
+		hdr.Typeflag = tar.TypeFifo
+	case st.mode&fs.ModeCharDevice != 0:
+		hdr.Typeflag = tar.TypeChar
+	case st.mode&fs.ModeDevice != 0:
+		hdr.Typeflag = tar.TypeBlock
+	default:
+		return nil, fmt.Errorf("unexpected file mode for archive, mode= %s", st.mode)
+	}
+
+	fillArchiveHeader(hdr, st)
+	return hdr, nil
+}
+
+// writeArchiveDirs writes headers of parent dirs of name, which are not written yet.
+func (c *Copyer) writeArchiveDirs(name string) error {
+	a := c.archive
+	if a.dirs == nil {
+		a.dirs = make(map[string]*stat, len(c.dirs))
+		for _, d := range c.dirs {
+			a.dirs[strings.TrimPrefix(d.src.path, "/")] = d.stat
+		}
+	}
+
+	parents := make([]string, 0, 4)
+	for dir := path.Dir(name); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if _, has := a.written[dir]; has {
+			break
+		}
+		parents = append(parents, dir)
+	}
+
+	for idx := len(parents) - 1; idx >= 0; idx-- {
+		dir := parents[idx]
+		hdr := &tar.Header{Typeflag: tar.TypeDir, Name: dir + "/", Mode: 0o755, ModTime: time.Now(), Format: tar.FormatPAX}
+		if st, has := a.dirs[dir]; has {
+			hdr.Mode, hdr.ModTime = int64(st.mode.Perm()), st.modTime
+			fillArchiveHeader(hdr, st)
+		}
+
+		if err := a.tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("write dir header fail, %w", err)
+		}
+		a.written[dir] = struct{}{}
+	}
+	return nil
+}
+
+// beginArchive writes header of job, and returns the offset of it.
+func (c *Copyer) beginArchive(job *baseJob, size int64) (int64, error) {
+	a := c.archive
+	if a.err != nil {
+		return 0, fmt.Errorf("archive is broken, %w", a.err)
+	}
+
+	hdr, err := c.archiveHeader(job, size)
+	if err != nil {
+		return 0, err
+	}
+	if a.tape != nil && a.tape.archiveSize > 0 && a.counter.n >= a.tape.archiveSize {
+		if err := a.nextTapeFile(); err != nil {
+			a.err = err
+			return 0, err
+		}
+	}
+	if err := c.writeArchiveDirs(strings.TrimSuffix(hdr.Name, "/")); err != nil {
+		a.err = err
+		return 0, err
+	}
+
+	offset := a.counter.n
+	if err := a.tw.WriteHeader(hdr); err != nil {
+		a.err = err
+		return 0, fmt.Errorf("write header fail, %w", err)
+	}
+	if hdr.Typeflag == tar.TypeDir {
+		a.written[strings.TrimSuffix(hdr.Name, "/")] = struct{}{}
+	}
+	return offset, nil
+}
+
+// endArchive pads the member, and records it into job.
+func (c *Copyer) endArchive(job *baseJob, offset int64, err error) {
+	a := c.archive
+	if ferr := a.tw.Flush(); ferr != nil && err == nil {
+		err = fmt.Errorf("flush archive fail, %w", ferr)
+	}
+	if a.counter.err != nil && a.err == nil {
+		a.err = a.counter.err
+	}
+	if err != nil {
+		job.fail(a.name, fmt.Errorf("write archive fail, %w", mappingError(err)))
+		return
+	}
+
+	name := archiveName(job)
+	a.members[job] = name
+
+	member := &ArchiveMember{Name: name, Offset: offset}
+	if a.tape != nil {
+		member.File, member.Block = a.tapeIndex, offset/int64(a.tape.blockSize)
+	}
+
+	job.lock.Lock()
+	job.archive = member
+	job.lock.Unlock()
+}
+
+// nextTapeFile ends the current archive by a filemark, and starts a new archive in the next tape file.
+// Parent dirs are written again, so each archive can be restored alone.
+func (a *archiveTarget) nextTapeFile() error {
+	if err := a.tw.Close(); err != nil {
+		return fmt.Errorf("close archive fail, %w", err)
+	}
+	if err := a.tapeFile.filemark(); err != nil {
+		return err
+	}
+
+	a.counter = &countWriter{w: a.tapeFile}
+	a.tw = tar.NewWriter(a.counter)
+	a.written = make(map[string]struct{}, 64)
+	a.tapeIndex++
+	return nil
+}
+
+// writeArchiveMeta writes the member without data, such like dirs, links and device files.
+func (c *Copyer) writeArchiveMeta(job *baseJob) {
+	offset, err := c.beginArchive(job, 0)
+	if err != nil {
+		job.fail(c.archive.name, fmt.Errorf("write archive fail, %w", err))
+		return
+	}
+	c.endArchive(job, offset, nil)
+}
+
+// writeArchiveData writes the regular file member from chunks, the member is padded with zeros
+// if source is shorter than the size in header, to keep the archive readable.
+func (c *Copyer) writeArchiveData(ctx context.Context, job *writeJob, ch <-chan *chunk, readErr *error) {
+	offset, err := c.beginArchive(job.baseJob, job.size)
+	if err != nil {
+		for range ch {
+		}
+		job.fail(c.archive.name, fmt.Errorf("write archive fail, %w", err))
+		return
+	}
+
+	tw := c.archive.tw
+	var written int64
+	for chk := range ch {
+		if err != nil {
+			continue
+		}
+
+		if err = c.toLimiter.wait(ctx, chk.len()); err != nil {
+			continue
+		}
+		if chk.hole > 0 {
+			err = writeZero(tw, chk.hole)
+		} else {
+			_, err = tw.Write(chk.data)
+		}
+		written += chk.len()
+	}
+	if err == nil && *readErr != nil {
+		err = *readErr
+	}
+	if written < job.size && c.archive.counter.err == nil {
+		if perr := writeZero(tw, job.size-written); perr != nil && err == nil {
+			err = perr
+		}
+		if err == nil {
+			err = fmt.Errorf("src file is shorter than archive header, want= %d read= %d", job.size, written)
+		}
+	}
+
+	c.endArchive(job.baseJob, offset, err)
+}
+
+func (c *Copyer) closeArchive() {
+	a := c.archive
+	if a == nil || a.tw == nil {
+		return
+	}
+
+	if err := a.tw.Close(); err != nil {
+		c.reportError("", a.name, fmt.Errorf("close archive fail, %w", err))
+	}
+	if a.closer != nil {
+		if err := a.closer.Close(); err != nil {
+			c.reportError("", a.name, fmt.Errorf("close archive file fail, %w", err))
+		}
+	}
+}
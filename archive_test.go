@@ -0,0 +1,95 @@
+package acp
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTarTarget(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "src")
+	writeTestFile(t, filepath.Join(src, "b.txt"), "bbbb")
+	writeTestFile(t, filepath.Join(src, "a", "c.txt"), "cccc")
+	writeTestFile(t, filepath.Join(src, "a", "b", "d.txt"), "")
+	mkdirTest(t, filepath.Join(src, "empty"))
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(src, "b.txt"), mtime, mtime); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+
+	buf := new(bytes.Buffer)
+	report := runCopyer(t, WildcardJob(Source(src)), WithTarTarget(buf), WithEmptyDirs(true))
+	if len(report.Errors) > 0 {
+		t.Fatalf("unexpected errors: %v", report.Errors[0])
+	}
+
+	archive := buf.Bytes()
+	names := make([]string, 0)
+	contents := make(map[string]string)
+	tr := tar.NewReader(bytes.NewReader(archive))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read archive: %v", err)
+		}
+
+		names = append(names, hdr.Name)
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("read member %s: %v", hdr.Name, err)
+		}
+		contents[hdr.Name] = string(data)
+		if hdr.Name == "src/b.txt" && !hdr.ModTime.Equal(mtime) {
+			t.Fatalf("unexpected mtime: %s", hdr.ModTime)
+		}
+	}
+
+	want := []string{"src/", "src/a/", "src/a/b/", "src/a/b/d.txt", "src/a/c.txt", "src/b.txt", "src/empty/"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("unexpected members: %v", names)
+	}
+	if contents["src/b.txt"] != "bbbb" || contents["src/a/c.txt"] != "cccc" {
+		t.Fatalf("unexpected contents: %v", contents)
+	}
+
+	// members can be read from the offset in report
+	for _, name := range []string{"a/c.txt", "b.txt"} {
+		job := findReportJob(report, "src/"+name)
+		if job == nil || job.Archive == nil || job.Archive.Name != "src/"+name {
+			t.Fatalf("unexpected job: %+v", job)
+		}
+
+		hdr, err := tar.NewReader(bytes.NewReader(archive[job.Archive.Offset:])).Next()
+		if err != nil || hdr.Name != job.Archive.Name {
+			t.Fatalf("read member from offset %d: %v, %v", job.Archive.Offset, hdr, err)
+		}
+	}
+}
+
+func TestTarTargetDryRun(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "src")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "aaaa")
+	tarPath, tapePath := filepath.Join(root, "exist.tar"), filepath.Join(root, "tape")
+	writeTestFile(t, tarPath, "old data")
+	writeTestFile(t, tapePath, "old tape")
+
+	// archive targets are opened after dry run is checked, existing files are kept
+	runCopyer(t, WildcardJob(Source(src)), WithTarTargetFile(tarPath), WithDryRun(true))
+	runCopyer(t, WildcardJob(Source(src)), WithTapeTarget(tapePath), WithDryRun(true))
+	for path, want := range map[string]string{tarPath: "old data", tapePath: "old tape"} {
+		got, err := os.ReadFile(path)
+		if err != nil || string(got) != want {
+			t.Fatalf("archive target is touched by dry run, %s: %q, %v", path, got, err)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package acp
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/samber/lo"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	tmpFileSuffix = ".acp-tmp"
+)
+
+// WithAtomicWrite write data into a hidden temp file in the same dir of target, and rename it
+// into place after the job is finished, so a target path is either absent or complete.
+// Temp files left by a killed copy are removed from dirs of walked targets before copying,
+// including targets skipped by resume or update policy.
+func WithAtomicWrite(b bool) Option {
+	return func(o *option) *option {
+		o.atomicWrite = b
+		return o
+	}
+}
+
+// tmpPath returns the temp file path of target, such like `dir/.name.acp-tmp`.
+func tmpPath(target string) string {
+	dir, name := path.Split(target)
+	return path.Join(dir, "."+name+tmpFileSuffix)
+}
+
+func isTmpName(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, tmpFileSuffix)
+}
+
+// cleanupTmpFiles removes stale temp files in dir, each dir is only scanned once,
+// and before any temp file is created in it by this copyer.
+func (c *Copyer) cleanupTmpFiles(dir string) {
+	c.tmpCleaner(dir).Do(func() {
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			return
+		}
+		if err != nil {
+			c.logf(logrus.WarnLevel, "read dir for cleanup temp files fail, dir= '%s', %s", dir, err)
+			return
+		}
+
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() || !isTmpName(entry.Name()) {
+				continue
+			}
+
+			p := path.Join(dir, entry.Name())
+			if err := os.Remove(p); err != nil {
+				c.reportError("", p, fmt.Errorf("delete stale temp file fail, %w", err))
+				continue
+			}
+			c.logf(logrus.InfoLevel, "stale temp file deleted, path= '%s'", p)
+		}
+	})
+}
+
+// cleanupTargetDirs removes stale temp files in dirs of walked targets, so they are removed
+// even if nothing is written into the dir again. Targets of dir are cleaned themselves.
+func (c *Copyer) cleanupTargetDirs(targets []string, isDir bool) {
+	if !c.atomicWrite || c.dryRun {
+		return
+	}
+
+	for _, target := range targets {
+		if !isDir {
+			target = path.Dir(target)
+		}
+		c.cleanupTmpFiles(target)
+	}
+}
+
+// openAtomic opens the temp file of target for writing.
+func (c *Copyer) openAtomic(job *writeJob, target string) (*os.File, string, error) {
+	c.cleanupTmpFiles(path.Dir(target))
+
+	if c.createFlag&os.O_EXCL != 0 {
+		if _, err := os.Lstat(target); err == nil {
+			return nil, "", fmt.Errorf("dst file exists, %w", os.ErrExist)
+		}
+	}
+
+	tmp := tmpPath(target)
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, job.stat.mode)
+	if err != nil {
+		return nil, "", err
+	}
+
+	job.setTmpTarget(target, tmp)
+	return file, tmp, nil
+}
+
+// commitTmpFiles renames temp files of success targets into place, and removes others.
+func (c *Copyer) commitTmpFiles(job *baseJob) {
+	job.lock.Lock()
+	tmps := job.tmpTargets
+	job.tmpTargets = nil
+	successTargets := append([]string(nil), job.successTargets...)
+	job.lock.Unlock()
+
+	// targets created after the temp file is opened are not overwritten
+	rename := os.Rename
+	if c.createFlag&os.O_EXCL != 0 {
+		rename = renameNoReplace
+	}
+
+	dirs := make(map[string][]string, 1)
+	for target, tmp := range tmps {
+		if !lo.Contains(successTargets, target) {
+			if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+				c.reportError(job.path, tmp, fmt.Errorf("delete temp file fail, %w", err))
+			}
+			continue
+		}
+
+		if err := rename(tmp, target); err != nil {
+			if errors.Is(err, os.ErrExist) {
+				err = fmt.Errorf("dst file exists, %w", err)
+			}
+			job.revoke(target, fmt.Errorf("rename temp file into place fail, %w", mappingError(err)))
+			if err := os.Remove(tmp); err != nil {
+				c.reportError(job.path, tmp, fmt.Errorf("delete temp file fail, %w", err))
+			}
+			continue
+		}
+
+		dir := path.Dir(target)
+		dirs[dir] = append(dirs[dir], target)
+	}
+
+	// renames are durable after their dirs are synced
+	for dir, targets := range dirs {
+		if err := syncDir(dir); err != nil {
+			for _, target := range targets {
+				job.revoke(target, fmt.Errorf("sync dir of target fail, %w", mappingError(err)))
+			}
+		}
+	}
+}
+
+// linkRename renames old to new by link and unlink, fails with EEXIST if new exists.
+func linkRename(old, new string) error {
+	if err := os.Link(old, new); err != nil {
+		return err
+	}
+	return os.Remove(old)
+}
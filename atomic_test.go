@@ -0,0 +1,120 @@
+package acp
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAtomicWrite(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "src"), filepath.Join(root, "dst")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "aaaa")
+	writeTestFile(t, filepath.Join(src, "sub", "b.txt"), "bbbb")
+
+	stale := filepath.Join(dst, "src", "sub", ".old.txt"+tmpFileSuffix)
+	writeTestFile(t, stale, "broken")
+
+	report := runCopyer(t, WildcardJob(Source(src), Target(dst)), WithAtomicWrite(true), WithVerify(true))
+	if len(report.Errors) > 0 {
+		t.Fatalf("unexpected errors: %v", report.Errors[0])
+	}
+	for _, job := range report.Jobs {
+		if job.Status != JobStatusFinished || len(job.SuccessTargets) != 1 {
+			t.Fatalf("unexpected job: %+v", job)
+		}
+	}
+
+	for name, want := range map[string]string{"a.txt": "aaaa", "sub/b.txt": "bbbb"} {
+		got, err := os.ReadFile(filepath.Join(dst, "src", name))
+		if err != nil || string(got) != want {
+			t.Fatalf("read %s: got %q, %v", name, got, err)
+		}
+		if _, err := os.Stat(tmpPath(filepath.Join(dst, "src", name))); !os.IsNotExist(err) {
+			t.Fatalf("temp file of %s is left, %v", name, err)
+		}
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Fatalf("stale temp file is not deleted, %v", err)
+	}
+}
+
+func TestAtomicWriteCleanupSkippedDir(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "src"), filepath.Join(root, "dst")
+	writeTestFile(t, filepath.Join(src, "sub", "a.txt"), "aaaa")
+	mkdirTest(t, dst)
+
+	if report := runCopyer(t, WildcardJob(Source(src), Target(dst)), WithAtomicWrite(true)); len(report.Errors) > 0 {
+		t.Fatalf("unexpected errors: %v", report.Errors[0])
+	}
+
+	// nothing is written into the dir again, as the only file is skipped by update policy
+	stale := filepath.Join(dst, "src", "sub", ".old.txt"+tmpFileSuffix)
+	writeTestFile(t, stale, "broken")
+	report := runCopyer(t, WildcardJob(Source(src), Target(dst)), WithAtomicWrite(true), UpdatePolicy(UpdateSizeMtime))
+	if job := findReportJob(report, "src/sub/a.txt"); job == nil || job.Status != JobStatusSkipped {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Fatalf("stale temp file is not deleted, %v", err)
+	}
+}
+
+func TestAtomicWriteNotOverwrite(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "src"), filepath.Join(root, "dst")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "new")
+	writeTestFile(t, filepath.Join(dst, "src", "a.txt"), "old")
+
+	report := runCopyer(t, WildcardJob(Source(src), Target(dst)), WithAtomicWrite(true), Overwrite(false))
+	job := findReportJob(report, "src/a.txt")
+	target := filepath.Join(dst, "src", "a.txt")
+	if job == nil || !errors.Is(job.FailTargets[target], os.ErrExist) {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+
+	got, err := os.ReadFile(target)
+	if err != nil || string(got) != "old" {
+		t.Fatalf("target is changed: %q, %v", got, err)
+	}
+}
+
+func TestAtomicCommitNoReplace(t *testing.T) {
+	root := t.TempDir()
+	target, created := filepath.Join(root, "a.txt"), filepath.Join(root, "b.txt")
+	writeTestFile(t, tmpPath(target), "new")
+	writeTestFile(t, tmpPath(created), "new")
+	// created by others after the temp file is opened
+	writeTestFile(t, created, "others")
+
+	opt := newOption()
+	if err := opt.check(); err != nil {
+		t.Fatalf("check option: %v", err)
+	}
+	c := &Copyer{option: opt, eventCh: make(chan Event, 8)}
+
+	job := &baseJob{
+		copyer:         c,
+		src:            &source{base: root, path: "a.txt"},
+		stat:           &stat{},
+		path:           "src",
+		successTargets: []string{target, created},
+		tmpTargets:     map[string]string{target: tmpPath(target), created: tmpPath(created)},
+	}
+	c.commitTmpFiles(job)
+
+	for path, want := range map[string]string{target: "new", created: "others"} {
+		got, err := os.ReadFile(path)
+		if err != nil || string(got) != want {
+			t.Fatalf("read %s: got %q, %v", path, got, err)
+		}
+		if _, err := os.Stat(tmpPath(path)); !os.IsNotExist(err) {
+			t.Fatalf("temp file of %s is left, %v", path, err)
+		}
+	}
+	if len(job.successTargets) != 1 || !errors.Is(job.failedTargets[created], os.ErrExist) {
+		t.Fatalf("unexpected job, success= %v failed= %v", job.successTargets, job.failedTargets)
+	}
+}
@@ -0,0 +1,115 @@
+package acp
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+)
+
+// DeviceBandwidth limits bytes per second read from or written to the device, zero means unlimited.
+// The limit counts bytes of every target, so two targets on a device with 10MB/s limit are written
+// in 5MB/s each, the same as targets on different devices sharing the to device limit.
+func DeviceBandwidth(bytesPerSec int64) DeviceOption {
+	return func(d *deviceOption) *deviceOption {
+		d.bandwidth = bytesPerSec
+		return d
+	}
+}
+
+// SetBandwidth changes bandwidth limits of from device and to device while copying, zero means unlimited.
+// The to device limit is shared by all targets, limits of devices set by SetTargetDevice are changed by
+// SetDeviceBandwidth. Waiting readers and writers get the new limit immediately.
+func (c *Copyer) SetBandwidth(from, to int64) {
+	c.fromLimiter.setRate(from)
+	c.toLimiter.setRate(to)
+}
+
+// SetDeviceBandwidth changes the bandwidth limit of a device set by SetTargetDevice while copying,
+// zero means unlimited. Targets are limited by both this limit and the to device limit.
+func (c *Copyer) SetDeviceBandwidth(mountPoint string, bytesPerSec int64) error {
+	l, has := c.deviceLimiters[path.Clean(mountPoint)]
+	if !has {
+		return fmt.Errorf("device is not set by SetTargetDevice, '%s'", mountPoint)
+	}
+
+	l.setRate(bytesPerSec)
+	return nil
+}
+
+// bandwidthLimiter is a token bucket, tokens are bytes and refilled in rate per second.
+// Bucket holds at most one second of tokens. Callers may take more tokens than the bucket has,
+// the debt is paid by the following callers, so chunks larger than rate are allowed.
+type bandwidthLimiter struct {
+	lock    sync.Mutex
+	rate    int64
+	tokens  float64
+	last    time.Time
+	changed chan struct{}
+}
+
+func newBandwidthLimiter(rate int64) *bandwidthLimiter {
+	return &bandwidthLimiter{rate: rate, last: time.Now(), changed: make(chan struct{})}
+}
+
+func (l *bandwidthLimiter) refill(now time.Time) {
+	if l.rate > 0 {
+		l.tokens += now.Sub(l.last).Seconds() * float64(l.rate)
+		if burst := float64(l.rate); l.tokens > burst {
+			l.tokens = burst
+		}
+	}
+	l.last = now
+}
+
+func (l *bandwidthLimiter) setRate(rate int64) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.refill(time.Now())
+	l.rate = rate
+	if rate <= 0 || l.tokens > float64(rate) {
+		l.tokens = 0
+	}
+
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// wait blocks until the bucket is not in debt, then takes n tokens. Nil limiter is unlimited.
+func (l *bandwidthLimiter) wait(ctx context.Context, n int64) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+
+	for {
+		l.lock.Lock()
+		if l.rate <= 0 {
+			l.lock.Unlock()
+			return nil
+		}
+
+		now := time.Now()
+		l.refill(now)
+		if l.tokens >= 0 {
+			l.tokens -= float64(n)
+			l.lock.Unlock()
+			return nil
+		}
+
+		delay := time.Duration(-l.tokens / float64(l.rate) * float64(time.Second))
+		changed := l.changed
+		l.lock.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-changed:
+			timer.Stop()
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package acp
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDeviceBandwidth(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "src"), filepath.Join(root, "dst")
+	mkdirTest(t, dst)
+	data := bytes.Repeat([]byte{'a'}, 3*batchSize)
+	writeTestFile(t, filepath.Join(src, "a.bin"), string(data))
+
+	start := time.Now()
+	report := runCopyer(t, WildcardJob(Source(src), Target(dst)), SetToDevice(DeviceBandwidth(2*batchSize)))
+	if len(report.Errors) > 0 {
+		t.Fatalf("unexpected errors: %v", report.Errors[0])
+	}
+	// first chunk is written at once, the other two wait for half second each
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Fatalf("bandwidth is not limited, elapsed= %s", elapsed)
+	}
+
+	got, err := os.ReadFile(filepath.Join(dst, "src", "a.bin"))
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("unexpected target, len= %d, err= %v", len(got), err)
+	}
+}
+
+func TestDeviceBandwidthSharedTargets(t *testing.T) {
+	root := t.TempDir()
+	src, dst1, dst2 := filepath.Join(root, "src"), filepath.Join(root, "dst1"), filepath.Join(root, "dst2")
+	mkdirTest(t, dst1, dst2)
+	data := bytes.Repeat([]byte{'a'}, 2*batchSize)
+	writeTestFile(t, filepath.Join(src, "a.bin"), string(data))
+
+	// both targets are on the same device, the first chunk is written at once,
+	// and the second one waits for two chunks of both targets
+	start := time.Now()
+	report := runCopyer(t, WildcardJob(Source(src), Target(dst1, dst2)), SetToDevice(DeviceBandwidth(2*batchSize)))
+	if len(report.Errors) > 0 {
+		t.Fatalf("unexpected errors: %v", report.Errors[0])
+	}
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Fatalf("bandwidth is not shared by targets, elapsed= %s", elapsed)
+	}
+}
+
+func TestBandwidthLimiterSetRate(t *testing.T) {
+	l := newBandwidthLimiter(1)
+	if err := l.wait(context.Background(), batchSize); err != nil {
+		t.Fatalf("first wait: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- l.wait(context.Background(), batchSize) }()
+
+	select {
+	case err := <-done:
+		t.Fatalf("wait is not blocked, %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	l.setRate(0)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected wait error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("wait is not released by unlimited rate")
+	}
+
+	l.setRate(1)
+	l.tokens = -batchSize
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.wait(ctx, 1); err == nil {
+		t.Fatalf("wait should fail after context canceled")
+	}
+}
+
+func TestSetDeviceBandwidth(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "src"), filepath.Join(root, "dst")
+	data := bytes.Repeat([]byte{'a'}, 8*batchSize)
+	writeTestFile(t, filepath.Join(src, "a.bin"), string(data))
+	writeTestFile(t, filepath.Join(dst, ".keep"), "")
+
+	getDevice, err := getMountpointCache()
+	if err != nil {
+		t.Fatalf("get mount points: %v", err)
+	}
+	dev := getDevice(root)
+
+	start := time.Now()
+	c, err := New(context.Background(), WildcardJob(Source(src), Target(dst)), SetTargetDevice(dev, DeviceBandwidth(batchSize)))
+	if err != nil {
+		t.Fatalf("new copyer: %v", err)
+	}
+	if err := c.SetDeviceBandwidth(filepath.Join(root, "not-a-device"), 0); err == nil {
+		t.Fatalf("unknown device should fail")
+	}
+	// unlimited at runtime, it takes 7 seconds with the initial limit
+	if err := c.SetDeviceBandwidth(dev, 0); err != nil {
+		t.Fatalf("set device bandwidth: %v", err)
+	}
+	c.Wait()
+
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("device bandwidth is not changed, elapsed= %s", elapsed)
+	}
+	got, err := os.ReadFile(filepath.Join(dst, "src", "a.bin"))
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("unexpected target, len= %d, err= %v", len(got), err)
+	}
+}
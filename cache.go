@@ -1,8 +1,14 @@
 package acp
 
+import "sync"
+
 func Cache[K comparable, V any](f func(in K) V) func(in K) V {
+	var lock sync.Mutex
 	cache := make(map[K]V, 0)
 	return func(in K) V {
+		lock.Lock()
+		defer lock.Unlock()
+
 		cached, has := cache[in]
 		if has {
 			return cached
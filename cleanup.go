@@ -3,9 +3,49 @@ package acp
 import (
 	"context"
 	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/samber/lo"
 )
 
 func (c *Copyer) cleanupJob(ctx context.Context, copyed <-chan *baseJob) {
+	// jobs waiting for the job they are hard linked to
+	pendingLinks := make(map[*baseJob][]*baseJob)
+	defer func() {
+		for primary, links := range pendingLinks {
+			for _, job := range links {
+				for _, target := range job.targets {
+					job.fail(target, fmt.Errorf("hard link source is not finished, '%s'", primary.path))
+				}
+				job.setStatus(jobStatusFinished)
+			}
+		}
+	}()
+
+	var finish func(job *baseJob)
+	finish = func(job *baseJob) {
+		if job.linkTo != nil {
+			c.linkJob(job)
+		} else {
+			for _, dst := range job.successTargets {
+				if err := writeSysStat(job.writePath(dst), job.stat); err != nil {
+					c.reportError(job.path, dst, fmt.Errorf("change info, write sys stat fail, %w", err))
+				}
+			}
+			c.commitTmpFiles(job)
+		}
+
+		job.setStatus(jobStatusFinished)
+
+		links := pendingLinks[job]
+		delete(pendingLinks, job)
+		for _, link := range links {
+			finish(link)
+		}
+	}
+
 	for {
 		select {
 		case job, ok := <-copyed:
@@ -13,15 +53,102 @@ func (c *Copyer) cleanupJob(ctx context.Context, copyed <-chan *baseJob) {
 				return
 			}
 
-			for _, dst := range job.successTargets {
-				if err := writeSysStat(dst, job.stat); err != nil {
-					c.reportError(job.path, dst, fmt.Errorf("change info, write sys stat fail, %w", err))
-				}
+			if job.linkTo != nil && !job.linkTo.isFinished() {
+				pendingLinks[job.linkTo] = append(pendingLinks[job.linkTo], job)
+				continue
 			}
 
-			job.setStatus(jobStatusFinished)
+			finish(job)
 		case <-ctx.Done():
 			return
 		}
 	}
 }
+
+type dirJob struct {
+	src     *source
+	path    string
+	stat    *stat
+	targets []string
+}
+
+// cleanupDirs applies metadata of source dirs to target dirs, after all files are finished.
+// Dirs are handled bottom-up, so the mtime of parent will not be changed by its children.
+func (c *Copyer) cleanupDirs(ctx context.Context) {
+	for idx := len(c.dirs) - 1; idx >= 0; idx-- {
+		if ctx.Err() != nil {
+			return
+		}
+
+		dir := c.dirs[idx]
+		for _, target := range dir.targets {
+			fi, err := os.Lstat(target)
+			if err != nil || !fi.IsDir() {
+				continue
+			}
+
+			if err := writeSysStat(target, dir.stat); err != nil {
+				c.reportError(dir.path, target, fmt.Errorf("change dir info, write sys stat fail, %w", err))
+			}
+		}
+	}
+}
+
+// linkJob creates hard links on targets of job, which point to the finished targets of the linked job.
+func (c *Copyer) linkJob(job *baseJob) {
+	primary := job.linkTo
+	job.linkSpan()
+
+	// unchanged targets skipped by update policy are linked to as well
+	primary.lock.Lock()
+	successTargets := append(append([]string(nil), primary.successTargets...), primary.skipTargets...)
+	hashes := primary.hashes
+	primary.lock.Unlock()
+
+	job.lock.Lock()
+	job.hashes = hashes
+	job.lock.Unlock()
+
+	linked := make(map[string]struct{}, len(job.targets))
+	for _, src := range successTargets {
+		if !strings.HasSuffix(src, primary.src.path) {
+			continue
+		}
+
+		dst := job.src.dst(strings.TrimSuffix(src, primary.src.path))
+		if !lo.Contains(job.targets, dst) {
+			continue
+		}
+
+		linked[dst] = struct{}{}
+		if err := c.createLink(src, dst); err != nil {
+			job.fail(dst, fmt.Errorf("create hard link fail, %w", mappingError(err)))
+			continue
+		}
+		job.success(dst)
+	}
+
+	for _, target := range job.targets {
+		if _, has := linked[target]; has {
+			continue
+		}
+		job.fail(target, fmt.Errorf("hard link source is not copied to target, '%s'", primary.path))
+	}
+}
+
+func (c *Copyer) createLink(src, dst string) error {
+	if err := os.MkdirAll(path.Dir(dst), os.ModePerm); err != nil {
+		return fmt.Errorf("mkdir dst dir fail, %w", err)
+	}
+
+	if _, err := os.Lstat(dst); err == nil {
+		if c.createFlag&os.O_EXCL != 0 {
+			return fmt.Errorf("dst file exists, %w", os.ErrExist)
+		}
+		if err := os.Remove(dst); err != nil {
+			return fmt.Errorf("remove exists dst file fail, %w", err)
+		}
+	}
+
+	return os.Link(src, dst)
+}
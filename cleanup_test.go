@@ -0,0 +1,44 @@
+package acp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCleanupDirs(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "src"), filepath.Join(root, "dst")
+	writeTestFile(t, filepath.Join(src, "sub", "deep", "a.txt"), "aaaa")
+	mkdirTest(t, dst)
+
+	modTimes := map[string]time.Time{
+		"src":          time.Unix(1600000000, 0),
+		"src/sub":      time.Unix(1600001000, 0),
+		"src/sub/deep": time.Unix(1600002000, 0),
+	}
+	if err := os.Chmod(filepath.Join(src, "sub"), 0o700); err != nil {
+		t.Fatalf("chmod: %v", err)
+	}
+	for name, mt := range modTimes {
+		if err := os.Chtimes(filepath.Join(root, name), mt, mt); err != nil {
+			t.Fatalf("chtimes %s: %v", name, err)
+		}
+	}
+
+	runCopyer(t, WildcardJob(Source(src), Target(dst)))
+
+	for name, mt := range modTimes {
+		fi, err := os.Stat(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatalf("stat %s: %v", name, err)
+		}
+		if !fi.ModTime().Equal(mt) {
+			t.Errorf("dir %s mtime= %s want= %s", name, fi.ModTime(), mt)
+		}
+	}
+	if fi, err := os.Stat(filepath.Join(dst, "src", "sub")); err != nil || fi.Mode().Perm() != 0o700 {
+		t.Fatalf("unexpected dir mode, fi= %v err= %v", fi, err)
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/samuelncui/acp"
+	"github.com/schollz/progressbar/v3"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	withProgressBar := flag.Bool("p", true, "display progress bar")
+	manifestPath := flag.String("manifest", "", "checksum manifest path, GNU or BSD (--tag) format")
+	fromReport := flag.String("from-report", "", "acp json or jsonl report path, use hashes in report as expectation")
+	algorithm := flag.String("hash", acp.HashSHA256, "hash algorithm, for GNU format manifest and report")
+	reportPath := flag.String("report", "", "json report storage path")
+	reportIndent := flag.Bool("report-indent", false, "json report with indent")
+	reportAll := flag.Bool("all", false, "report matched files too, not only mismatch, missing and extra files")
+	flag.Parse()
+
+	if (*manifestPath == "") == (*fromReport == "") {
+		logrus.Fatalf("one of '-manifest' and '-from-report' is required")
+	}
+
+	root := flag.Arg(0)
+	if root == "" {
+		root = "."
+		if *manifestPath != "" {
+			root = filepath.Dir(*manifestPath)
+		}
+	}
+	rootAbs, err := filepath.Abs(root)
+	if err != nil {
+		logrus.Fatalf("get abs root fail, %s", err)
+	}
+
+	var expected map[string][]*acp.ManifestEntry
+	if *manifestPath != "" {
+		expected, err = loadManifest(*manifestPath, *algorithm)
+	} else {
+		expected, err = loadReport(*fromReport, *algorithm)
+	}
+	if err != nil {
+		logrus.Fatalf("load expected hashes fail, %s", err)
+	}
+
+	ignores := make(map[string]struct{}, 3)
+	for _, p := range []string{*manifestPath, *reportPath, filepath.Join(rootAbs, acp.ManifestFileName(*algorithm))} {
+		if p == "" {
+			continue
+		}
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			logrus.Fatalf("get abs path fail, %s", err)
+		}
+		ignores[abs] = struct{}{}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var bar *progressbar.ProgressBar
+	if *withProgressBar {
+		bar = progressbar.NewOptions(len(expected), progressbar.OptionSetWriter(os.Stderr), progressbar.OptionShowCount())
+	}
+
+	report, err := verifyTree(ctx, rootAbs, expected, ignores, *reportAll, bar)
+	if err != nil {
+		logrus.Fatalf("verify fail, %s", err)
+	}
+
+	problems := countProblems(report)
+	if *reportPath != "" {
+		if err := os.WriteFile(*reportPath, []byte(report.ToJSONString(*reportIndent)), 0o644); err != nil {
+			logrus.Warnf("save report fail, path= '%s', err= %s", *reportPath, err)
+			logrus.Infof("report= %q", report.ToJSONString(false))
+		}
+	}
+	if problems > 0 {
+		logrus.Errorf("verify finished, problems= %d", problems)
+		os.Exit(1)
+	}
+	logrus.Infof("verify finished, files= %d", len(expected))
+}
+
+func loadManifest(path, algorithm string) (map[string][]*acp.ManifestEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries, err := acp.ReadManifest(f, algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	expected := make(map[string][]*acp.ManifestEntry, len(entries))
+	for _, e := range entries {
+		p := filepath.ToSlash(filepath.Clean(e.Path))
+		expected[p] = append(expected[p], e)
+	}
+	return expected, nil
+}
+
+func loadReport(path, algorithm string) (map[string][]*acp.ManifestEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	readReport := acp.ReadReport
+	if strings.HasSuffix(path, ".jsonl") {
+		readReport = acp.ReadJSONLReport
+	}
+
+	report, err := readReport(f)
+	if err != nil {
+		return nil, err
+	}
+
+	expected := make(map[string][]*acp.ManifestEntry, len(report.Jobs))
+	for _, job := range report.Jobs {
+		hash := job.Hashes[algorithm]
+		if hash == "" && algorithm == acp.HashSHA256 {
+			hash = job.SHA256
+		}
+		if hash == "" {
+			continue
+		}
+
+		expected[job.Path] = append(expected[job.Path], &acp.ManifestEntry{Algorithm: algorithm, Hash: hash, Path: job.Path})
+	}
+	return expected, nil
+}
+
+func verifyTree(
+	ctx context.Context, root string, expected map[string][]*acp.ManifestEntry,
+	ignores map[string]struct{}, reportAll bool, bar *progressbar.ProgressBar,
+) (*acp.Report, error) {
+	found := make(map[string]fs.FileInfo, len(expected))
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if _, has := ignores[p]; has {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		found[filepath.ToSlash(rel)] = info
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(expected))
+	for p := range expected {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	report := new(acp.Report)
+	for _, p := range paths {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		entries := expected[p]
+		fullPath := filepath.Join(root, filepath.FromSlash(p))
+		job := &acp.Job{FullPath: fullPath, Base: root, Path: p, Status: acp.JobStatusFinished}
+
+		info, has := found[p]
+		if bar != nil {
+			_ = bar.Add(1)
+		}
+		if !has {
+			job.FailTargets = map[string]error{fullPath: acp.ErrVerifyMissing}
+			report.Jobs = append(report.Jobs, job)
+			continue
+		}
+
+		job.Size, job.Mode, job.ModTime = info.Size(), info.Mode(), info.ModTime()
+		if err := checkEntries(job, entries); err != nil {
+			job.FailTargets = map[string]error{fullPath: err}
+			report.Jobs = append(report.Jobs, job)
+			continue
+		}
+
+		job.SuccessTargets = []string{fullPath}
+		if reportAll {
+			report.Jobs = append(report.Jobs, job)
+		}
+	}
+
+	extras := make([]string, 0)
+	for p := range found {
+		if _, has := expected[p]; !has {
+			extras = append(extras, p)
+		}
+	}
+	sort.Strings(extras)
+	for _, p := range extras {
+		report.Errors = append(report.Errors, &acp.Error{Dst: filepath.Join(root, filepath.FromSlash(p)), Err: acp.ErrVerifyExtra})
+	}
+
+	return report, nil
+}
+
+func checkEntries(job *acp.Job, entries []*acp.ManifestEntry) error {
+	algorithms := make([]string, 0, len(entries))
+	for _, e := range entries {
+		algorithms = append(algorithms, e.Algorithm)
+	}
+
+	hashes, err := acp.HashFile(job.FullPath, algorithms...)
+	if err != nil {
+		return err
+	}
+	job.Hashes, job.SHA256 = hashes, hashes[acp.HashSHA256]
+
+	for _, e := range entries {
+		if hashes[e.Algorithm] != e.Hash {
+			return fmt.Errorf("%w, hash= %s want= %s got= %s", acp.ErrVerifyMismatch, e.Algorithm, e.Hash, hashes[e.Algorithm])
+		}
+	}
+	return nil
+}
+
+func countProblems(report *acp.Report) int {
+	problems := len(report.Errors)
+	for _, job := range report.Jobs {
+		if len(job.FailTargets) > 0 {
+			problems++
+		}
+	}
+	return problems
+}
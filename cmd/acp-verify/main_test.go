@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/samuelncui/acp"
+)
+
+func TestVerifyTree(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{"ok.txt": "ok", "dir/bad.txt": "bad", "extra.txt": "extra"}
+	for name, content := range files {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	okHashes, err := acp.HashFile(filepath.Join(root, "ok.txt"), acp.HashSHA256)
+	if err != nil {
+		t.Fatalf("hash file: %v", err)
+	}
+	expected := map[string][]*acp.ManifestEntry{
+		"ok.txt":      {{Algorithm: acp.HashSHA256, Hash: okHashes[acp.HashSHA256], Path: "ok.txt"}},
+		"dir/bad.txt": {{Algorithm: acp.HashSHA256, Hash: okHashes[acp.HashSHA256], Path: "dir/bad.txt"}},
+		"missing.txt": {{Algorithm: acp.HashSHA256, Hash: okHashes[acp.HashSHA256], Path: "missing.txt"}},
+	}
+
+	report, err := verifyTree(context.Background(), root, expected, nil, false, nil)
+	if err != nil {
+		t.Fatalf("verify tree: %v", err)
+	}
+	if countProblems(report) != 3 {
+		t.Fatalf("problems = %d", countProblems(report))
+	}
+
+	reasons := make(map[string]error, len(report.Jobs))
+	for _, job := range report.Jobs {
+		reasons[job.Path] = job.FailTargets[job.FullPath]
+	}
+	if !errors.Is(reasons["dir/bad.txt"], acp.ErrVerifyMismatch) || !errors.Is(reasons["missing.txt"], acp.ErrVerifyMissing) {
+		t.Fatalf("unexpected reasons, %v", reasons)
+	}
+	if _, has := reasons["ok.txt"]; has {
+		t.Fatalf("matched file reported")
+	}
+	if len(report.Errors) != 1 || !errors.Is(report.Errors[0].Err, acp.ErrVerifyExtra) {
+		t.Fatalf("unexpected errors, %v", report.Errors)
+	}
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"flag"
+	"fmt"
+	"math"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 
 	"github.com/klauspost/cpuid/v2"
@@ -15,14 +19,42 @@ import (
 var (
 	withProgressBar = flag.Bool("p", true, "display progress bar")
 	notOverwrite    = flag.Bool("n", false, "not overwrite exist file")
-	// continueReport  = flag.String("c", "", "continue with previous report, for auto fill circumstances")
-	noTarget     = flag.Bool("notarget", false, "do not have target, use as dir index tool")
-	reportPath   = flag.String("report", "", "json report storage path")
-	reportIndent = flag.Bool("report-indent", false, "json report with indent")
-	fromLinear   = flag.Bool("from-linear", false, "copy from linear device, such like tape drive")
-	toLinear     = flag.Bool("to-linear", false, "copy to linear device, such like tape drive")
-
-	targetPaths []string
+	continueReport  = flag.String("c", "", "continue with previous report, skip finished targets")
+	noTarget        = flag.Bool("notarget", false, "do not have target, use as dir index tool")
+	reportPath      = flag.String("report", "", "json report storage path")
+	reportFormat    = flag.String("report-format", "json", "report format, can be 'json' or 'jsonl', jsonl report is written while copying")
+	reportIndent    = flag.Bool("report-indent", false, "json report with indent")
+	fromLinear      = flag.Bool("from-linear", false, "copy from linear device, such like tape drive")
+	toLinear        = flag.Bool("to-linear", false, "copy to linear device, such like tape drive")
+	verify          = flag.Bool("verify", false, "re-read targets after copy and compare sha256 with source")
+	hashes          = flag.String("hash", "", "extra hash algorithms split by comma, such like 'md5,xxh3,blake3'")
+	preserveLinks   = flag.Bool("links", false, "copy symbolic links as links, instead of the files they point to")
+	specialFiles    = flag.Bool("specials", false, "copy fifos and device files, copy device files requires root")
+	emptyDirs       = flag.Bool("empty-dirs", false, "copy empty dirs")
+	hardLinks       = flag.Bool("hard-links", false, "keep hard links, copy linked files only once")
+	sparse          = flag.Bool("sparse", true, "keep holes of sparse files, use '-sparse=false' to write holes as data")
+	atomicWrite     = flag.Bool("atomic", false, "write into hidden temp files, and rename them into place after finished, stale temp files in target dirs are removed")
+	updateMode      = flag.String("update", "", "skip unchanged exist targets, can be 'size-mtime', 'checksum', 'always' or 'never'")
+	dryRun          = flag.Bool("dryrun", false, "only plan actions of each target and check free space, use with '-report' to get the plan")
+	withDelete      = flag.Bool("delete", false, "delete files in targets which are not in sources, excluded files are kept")
+	deleteDryRun    = flag.Bool("delete-dryrun", false, "only print files which will be deleted by '-delete'")
+	fromTar         = flag.String("from-tar", "", "copy members of a tar archive at path, '-' for stdin, members are read only once")
+	tarPath         = flag.String("tar", "", "also write files into a pax archive at path, '-' for stdout, can be used without target")
+	tapePath        = flag.String("tape", "", "also write files into a tape drive like '/dev/nst0' as pax archives, can be used without target")
+	tapeBlock       = flag.String("tape-block", "256K", "fixed block size of tape, should be a multiple of 512, with optional suffix 'K' or 'M'")
+	tapeArchiveSize = flag.String("tape-archive-size", "", "start a new archive after a filemark when the archive is larger than it, with optional suffix 'K', 'M', 'G' or 'T', such like '100G'")
+	sourceOrder     = flag.String("order", "path", "read order of source files, can be 'path', 'inode' or 'extent', 'extent' is the physical order on linux")
+	reflink         = flag.String("reflink", "never", "clone files on the same file system, can be 'never', 'auto' or 'always'")
+	mediaPrompt     = flag.Bool("media-prompt", false, "wait for a new media when a target device is full or disappears, press enter after it is mounted")
+	retry           = flag.Int("retry", 0, "max tries of files failed by transient errors, such like ETIMEDOUT and ESTALE from network mounts")
+	bwlimit         = flag.String("bwlimit", "", "limit bytes written to targets per second, with optional suffix 'K', 'M', 'G' or 'T', such like '20M'")
+	spanSize        = flag.String("span-size", "", "max bytes written into each span volume, with optional suffix 'K', 'M', 'G' or 'T', such like '25G'")
+	manifestFormat  = flag.String("manifest", "", "write SHA256SUMS manifest into each target root, format can be 'gnu' or 'bsd', exist manifests are not overwritten")
+
+	targetPaths   []string
+	spanVolumes   []string
+	filterOpts    []acp.WildcardJobOption
+	targetDevices []acp.Option
 )
 
 func init() {
@@ -30,6 +62,30 @@ func init() {
 		targetPaths = append(targetPaths, s)
 		return nil
 	})
+	flag.Func("span", "spill files over volumes in order, next volume is used after one is full, can be given multi times", func(s string) error {
+		spanVolumes = append(spanVolumes, s)
+		return nil
+	})
+	flag.Func("include", "only copy files matching gitignore style pattern, can be given multi times", func(s string) error {
+		filterOpts = append(filterOpts, acp.Include(s))
+		return nil
+	})
+	flag.Func("exclude", "skip files matching gitignore style pattern, can be given multi times", func(s string) error {
+		filterOpts = append(filterOpts, acp.Exclude(s))
+		return nil
+	})
+	flag.Func("device", "options of a target device, like '/media/usb:threads=1,buffer=64M,bwlimit=10M,linear', can be given multi times", func(s string) error {
+		opt, err := parseTargetDevice(s)
+		if err != nil {
+			return err
+		}
+		targetDevices = append(targetDevices, opt)
+		return nil
+	})
+	flag.Func("exclude-from", "read exclude patterns from file, like '.gitignore'", func(s string) error {
+		filterOpts = append(filterOpts, acp.ExcludeFrom(s))
+		return nil
+	})
 }
 
 func main() {
@@ -40,33 +96,29 @@ func main() {
 	cpuid.Detect()
 
 	sources := flag.Args()
-	if len(sources) == 0 {
+	if len(sources) == 0 && *fromTar == "" {
 		logrus.Fatalf("cannot found source path")
 	}
 
-	if !*noTarget && len(targetPaths) == 0 {
+	if !*noTarget && *tarPath == "" && *tapePath == "" && len(targetPaths) == 0 && len(spanVolumes) == 0 {
+		if len(sources) == 0 {
+			logrus.Fatalf("cannot found target path")
+		}
+
 		targetPaths = append(targetPaths, sources[len(sources)-1])
 		sources = sources[:len(sources)-1]
 	}
-	if len(sources) == 0 {
+	if len(sources) == 0 && *fromTar == "" {
 		logrus.Fatalf("cannot found source path")
 	}
 
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, os.Interrupt)
-	go func() {
-		for sig := range signals {
-			if sig != os.Interrupt {
-				continue
-			}
-			cancel()
-		}
-	}()
 
 	opts := make([]acp.Option, 0, 8)
 
 	useAccurate := func() bool {
-		if *noTarget {
+		if *noTarget || len(targetPaths) == 0 || len(spanVolumes) > 0 || *fromTar != "" {
 			return false
 		}
 		if len(sources) > 1 {
@@ -102,28 +154,133 @@ func main() {
 	if useAccurate {
 		opts = append(opts, acp.AccurateJob(sources[0], []string{targetPaths[0]}))
 	} else {
-		opts = append(opts, acp.WildcardJob(acp.Source(sources...), acp.Target(targetPaths...)))
+		jobOpts := append([]acp.WildcardJobOption{acp.Source(sources...), acp.Target(targetPaths...)}, filterOpts...)
+		if len(spanVolumes) > 0 {
+			jobOpts = append(jobOpts, acp.SpanTarget(spanVolumes...))
+		}
+		order, err := acp.ParseSourceOrder(*sourceOrder)
+		if err != nil {
+			logrus.Fatalf("parse source order fail, %s", err)
+		}
+		jobOpts = append(jobOpts, acp.SourceOrderBy(order))
+		if *spanSize != "" {
+			size, err := parseSize(*spanSize)
+			if err != nil {
+				logrus.Fatalf("parse span size fail, %s", err)
+			}
+			jobOpts = append(jobOpts, acp.SpanVolumeSize(size))
+		}
+		switch *fromTar {
+		case "":
+		case "-":
+			jobOpts = append(jobOpts, acp.TarSourceReader("-", os.Stdin))
+		default:
+			jobOpts = append(jobOpts, acp.TarSource(*fromTar))
+		}
+		opts = append(opts, acp.WildcardJob(jobOpts...))
 	}
 
-	// if *continueReport != "" {
-	// 	f, err := os.Open(*continueReport)
-	// 	if err != nil {
-	// 		logrus.Fatalf("cannot open continue report file, %s", err)
-	// 	}
+	if *continueReport != "" {
+		f, err := os.Open(*continueReport)
+		if err != nil {
+			logrus.Fatalf("cannot open continue report file, %s", err)
+		}
 
-	// 	r := new(acp.Report)
-	// 	if err := json.NewDecoder(f).Decode(r); err != nil {
-	// 		logrus.Fatalf("decode continue report file, %s", err)
-	// 	}
+		readReport := acp.ReadReport
+		if strings.HasSuffix(*continueReport, ".jsonl") {
+			readReport = acp.ReadJSONLReport
+		}
+
+		r, err := readReport(f)
+		f.Close()
+		if err != nil {
+			logrus.Fatalf("decode continue report file, %s", err)
+		}
 
-	// 	for _, s := range r.NoSpaceSources {
-	// 		logrus.Infof("restore unfinished: base= '%s' relative_path= '%v'", s.Base, s.RelativePaths)
-	// 		opts = append(opts, acp.AccurateSource(s.Base, s.RelativePaths...))
-	// 	}
-	// }
+		opts = append(opts, acp.ResumeFromReport(r))
+	}
 
-	opts = append(opts, acp.WithHash(*reportPath != ""))
+	opts = append(opts, acp.WithHash(*reportPath != "" || *manifestFormat != ""))
+	opts = append(opts, acp.WithVerify(*verify))
+	if *hashes != "" {
+		opts = append(opts, acp.WithHashes(strings.Split(*hashes, ",")...))
+	}
 	opts = append(opts, acp.Overwrite(!*notOverwrite))
+	if *updateMode != "" {
+		mode, err := acp.ParseUpdateMode(*updateMode)
+		if err != nil {
+			logrus.Fatalf("parse update mode fail, %s", err)
+		}
+		opts = append(opts, acp.UpdatePolicy(mode))
+	}
+	opts = append(opts, acp.WithPreserveLinks(*preserveLinks))
+	opts = append(opts, acp.WithSpecialFiles(*specialFiles))
+	opts = append(opts, acp.WithEmptyDirs(*emptyDirs))
+	opts = append(opts, acp.WithHardLinks(*hardLinks))
+	opts = append(opts, acp.WithSparse(*sparse))
+	opts = append(opts, acp.WithAtomicWrite(*atomicWrite))
+	if *retry > 1 {
+		opts = append(opts, acp.WithRetry(acp.RetryPolicy{MaxAttempts: *retry}))
+	}
+	if *mediaPrompt {
+		if *fromTar == "-" {
+			logrus.Fatalf("media prompt cannot be used with tar archive from stdin")
+		}
+		opts = append(opts, acp.WithMediaChange(promptMedia))
+	}
+	switch *tarPath {
+	case "":
+	case "-":
+		opts = append(opts, acp.WithTarTarget(os.Stdout))
+	default:
+		opts = append(opts, acp.WithTarTargetFile(*tarPath))
+	}
+	if *tapePath != "" {
+		if *tarPath != "" {
+			logrus.Fatalf("tape cannot be used with tar target")
+		}
+
+		tapeOpts := make([]acp.TapeOption, 0, 2)
+		blockSize, err := parseSize(*tapeBlock)
+		if err != nil {
+			logrus.Fatalf("parse tape block size fail, %s", err)
+		}
+		// block size is set to drive as int32
+		if blockSize > math.MaxInt32 {
+			logrus.Fatalf("tape block size is too large, '%s'", *tapeBlock)
+		}
+		tapeOpts = append(tapeOpts, acp.TapeBlockSize(int(blockSize)))
+		if *tapeArchiveSize != "" {
+			size, err := parseSize(*tapeArchiveSize)
+			if err != nil {
+				logrus.Fatalf("parse tape archive size fail, %s", err)
+			}
+			tapeOpts = append(tapeOpts, acp.TapeArchiveSize(size))
+		}
+		opts = append(opts, acp.WithTapeTarget(*tapePath, tapeOpts...))
+	}
+	opts = append(opts, acp.WithDelete(*withDelete), acp.WithDeleteDryRun(*deleteDryRun))
+	opts = append(opts, acp.WithDryRun(*dryRun))
+	if *dryRun {
+		opts = append(opts, acp.WithEventHandler(func(ev acp.Event) {
+			if e, ok := ev.(*acp.EventPlanDevice); ok {
+				logrus.Infof("plan device, device= '%s', need= %d, free= %d", e.Device.Device, e.Device.Need, e.Device.Free)
+			}
+		}))
+	}
+	if *deleteDryRun || (*dryRun && *withDelete) {
+		opts = append(opts, acp.WithEventHandler(func(ev acp.Event) {
+			if e, ok := ev.(*acp.EventDelete); ok {
+				logrus.Infof("will delete, path= '%s'", e.Delete.Path)
+			}
+		}))
+	}
+
+	reflinkMode, err := acp.ParseReflinkMode(*reflink)
+	if err != nil {
+		logrus.Fatalf("parse reflink mode fail, %s", err)
+	}
+	opts = append(opts, acp.WithReflink(reflinkMode))
 
 	if *withProgressBar {
 		opts = append(opts, acp.WithProgressBar())
@@ -135,10 +292,50 @@ func main() {
 	if *toLinear {
 		opts = append(opts, acp.SetToDevice(acp.LinearDevice(true)))
 	}
+	opts = append(opts, targetDevices...)
+	if *bwlimit != "" {
+		bps, err := parseSize(*bwlimit)
+		if err != nil {
+			logrus.Fatalf("parse bandwidth limit fail, %s", err)
+		}
+		opts = append(opts, acp.SetToDevice(acp.DeviceBandwidth(bps)))
+	}
 
-	if *reportPath != "" {
-		handler, getter := acp.NewReportGetter()
+	useJSONL := *reportFormat == "jsonl"
+	if *reportFormat != "json" && !useJSONL {
+		logrus.Fatalf("unexpected report format, '%s'", *reportFormat)
+	}
+	var manifest acp.ManifestFormat
+	if *manifestFormat != "" {
+		format, err := acp.ParseManifestFormat(*manifestFormat)
+		if err != nil {
+			logrus.Fatalf("parse manifest format fail, %s", err)
+		}
+		manifest = format
+	}
+
+	var getter acp.ReportGetter
+	if (*reportPath != "" && !useJSONL) || *manifestFormat != "" {
+		var handler acp.EventHandler
+		handler, getter = acp.NewReportGetter()
+		opts = append(opts, acp.WithEventHandler(handler))
+	}
+	if *reportPath != "" && useJSONL {
+		r, err := os.Create(*reportPath)
+		if err != nil {
+			logrus.Fatalf("open report fail, path= '%s', err= %s", *reportPath, err)
+		}
+
+		handler, getErr := acp.NewJSONLReportWriter(r, 0)
 		opts = append(opts, acp.WithEventHandler(handler))
+		defer func() {
+			if err := getErr(); err != nil {
+				logrus.Warnf("write report fail, path= '%s', err= %s", *reportPath, err)
+			}
+			r.Close()
+		}()
+	}
+	if *reportPath != "" && !useJSONL {
 		defer func() {
 			if *reportPath == "" {
 				return
@@ -162,5 +359,128 @@ func main() {
 		logrus.Fatalf("unexpected exit: %s", err)
 	}
 
+	// first interrupt finishes files being copied, and the second one aborts
+	go func() {
+		stopping := false
+		for sig := range signals {
+			if sig != os.Interrupt {
+				continue
+			}
+			if !stopping {
+				stopping = true
+				logrus.Warnf("stopping after files being copied are finished, interrupt again to abort")
+				c.Stop(true)
+				continue
+			}
+			cancel()
+		}
+	}()
+
 	c.Wait()
+
+	if manifest != "" && !*dryRun {
+		written, err := getter().WriteManifests(acp.HashSHA256, manifest)
+		if err != nil {
+			logrus.Warnf("write manifest fail, %s", err)
+		}
+		for _, p := range written {
+			logrus.Infof("manifest written, path= '%s'", p)
+		}
+	}
+}
+
+// parseSize parses bytes like '512K', '20M' or '1.5G', suffixes 'K', 'M', 'G' and 'T' are in 1024.
+func parseSize(s string) (int64, error) {
+	num, unit := strings.TrimSpace(s), float64(1)
+	if idx := strings.IndexAny(strings.ToUpper(num), "KMGT"); idx >= 0 {
+		switch strings.ToUpper(strings.TrimSuffix(strings.TrimSuffix(num[idx:], "B"), "b")) {
+		case "K":
+			unit = 1 << 10
+		case "M":
+			unit = 1 << 20
+		case "G":
+			unit = 1 << 30
+		case "T":
+			unit = 1 << 40
+		default:
+			return 0, fmt.Errorf("unexpected unit, '%s'", s)
+		}
+		num = num[:idx]
+	}
+
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || !(n >= 0) || math.IsInf(n, 1) {
+		return 0, fmt.Errorf("unexpected size, '%s'", s)
+	}
+	// zero means unlimited, so values rounded down to zero are rejected
+	if bps := n * unit; bps > 0 && bps < 1 {
+		return 0, fmt.Errorf("value should be at least 1 byte, '%s'", s)
+	}
+	return int64(n * unit), nil
+}
+
+var stdin = bufio.NewReader(os.Stdin)
+
+// promptMedia asks user to mount a new media on stdin, input 'q' to give up the device.
+func promptMedia(ctx context.Context, e *acp.EventNeedMedia) error {
+	fmt.Fprintf(os.Stderr, "\ntarget device '%s' needs new media, %s\nmount a new media and press enter, or input 'q' to give up: ", e.Device, e.Error)
+
+	type input struct {
+		line string
+		err  error
+	}
+	ch := make(chan input, 1)
+	go func() {
+		line, err := stdin.ReadString('\n')
+		ch <- input{line: strings.TrimSpace(line), err: err}
+	}()
+
+	select {
+	case in := <-ch:
+		if in.err != nil {
+			return fmt.Errorf("read input fail, %w", in.err)
+		}
+		if strings.EqualFold(in.line, "q") {
+			return fmt.Errorf("given up by user")
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// parseTargetDevice parses options of target device like '/media/usb:threads=1,buffer=64M,bwlimit=10M,linear'.
+func parseTargetDevice(s string) (acp.Option, error) {
+	idx := strings.LastIndex(s, ":")
+	if idx <= 0 {
+		return nil, fmt.Errorf("cannot found mount point of device, '%s'", s)
+	}
+
+	mountPoint, devOpts := s[:idx], make([]acp.DeviceOption, 0, 4)
+	for _, kv := range strings.Split(s[idx+1:], ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(kv), "=")
+		switch key {
+		case "linear":
+			devOpts = append(devOpts, acp.LinearDevice(true))
+		case "threads":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("unexpected threads of device, '%s'", kv)
+			}
+			devOpts = append(devOpts, acp.DeviceThreads(n))
+		case "buffer", "bwlimit":
+			n, err := parseSize(value)
+			if err != nil {
+				return nil, fmt.Errorf("unexpected %s of device, %w", key, err)
+			}
+			if key == "buffer" {
+				devOpts = append(devOpts, acp.DeviceBuffer(n))
+			} else {
+				devOpts = append(devOpts, acp.DeviceBandwidth(n))
+			}
+		default:
+			return nil, fmt.Errorf("unexpected option of device, '%s'", kv)
+		}
+	}
+	return acp.SetTargetDevice(mountPoint, devOpts...), nil
 }
@@ -0,0 +1,207 @@
+package acp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+var (
+	ErrJobCanceled = fmt.Errorf("acp: job canceled")
+)
+
+const (
+	StateRunning  = "running"
+	StatePaused   = "paused"
+	StateStopping = "stopping"
+)
+
+type control struct {
+	lock sync.Mutex
+	// paused by Pause, or by media changes
+	paused bool
+	// pause of user and media changes are counted separately, copyer is resumed after both are ended
+	userPaused  bool
+	mediaPauses int
+	stopping    bool
+	closed      bool
+	// resumed is closed when copyer is resumed, only valid when paused
+	resumed  chan struct{}
+	canceled map[string]struct{}
+	cancel   context.CancelFunc
+	// events being submitted out of lock, event channel is closed after them
+	submitting sync.WaitGroup
+}
+
+// Pause pauses reading of sources, files being copied are paused after the current buffer,
+// and no more file is opened until Resume is called.
+func (c *Copyer) Pause() {
+	c.ctrl.lock.Lock()
+	if c.ctrl.userPaused || c.ctrl.stopping {
+		c.ctrl.lock.Unlock()
+		return
+	}
+
+	c.ctrl.userPaused = true
+	submit := c.updatePaused()
+	c.ctrl.lock.Unlock()
+
+	submit()
+}
+
+// Resume continues copying after Pause. Copying paused for media change keeps paused until the new media is mounted.
+func (c *Copyer) Resume() {
+	c.ctrl.lock.Lock()
+	if !c.ctrl.userPaused {
+		c.ctrl.lock.Unlock()
+		return
+	}
+
+	c.ctrl.userPaused = false
+	submit := c.updatePaused()
+	c.ctrl.lock.Unlock()
+
+	submit()
+}
+
+// pauseMedia pauses copying while waiting for new media, it should be ended by resumeMedia.
+func (c *Copyer) pauseMedia() {
+	c.ctrl.lock.Lock()
+	c.ctrl.mediaPauses++
+	submit := c.updatePaused()
+	c.ctrl.lock.Unlock()
+
+	submit()
+}
+
+func (c *Copyer) resumeMedia() {
+	c.ctrl.lock.Lock()
+	c.ctrl.mediaPauses--
+	submit := c.updatePaused()
+	c.ctrl.lock.Unlock()
+
+	submit()
+}
+
+// updatePaused should be called with lock of control held, it pauses or resumes copying by pauses of user
+// and media changes, returns the func submitting state change, see submitState.
+func (c *Copyer) updatePaused() func() {
+	paused := !c.ctrl.stopping && (c.ctrl.userPaused || c.ctrl.mediaPauses > 0)
+	if paused == c.ctrl.paused {
+		return func() {}
+	}
+
+	c.ctrl.paused = paused
+	if paused {
+		c.ctrl.resumed = make(chan struct{})
+		return c.submitState(StatePaused)
+	}
+	close(c.ctrl.resumed)
+	return c.submitState(StateRunning)
+}
+
+// CancelJob cancels the job of source path, which is the same as `Job.FullPath` in report.
+// Targets of the job are failed with ErrJobCanceled and partial written files are deleted.
+// Canceling a paused job takes effect after resume.
+func (c *Copyer) CancelJob(path string) {
+	c.ctrl.lock.Lock()
+	defer c.ctrl.lock.Unlock()
+
+	if c.ctrl.canceled == nil {
+		c.ctrl.canceled = make(map[string]struct{})
+	}
+	c.ctrl.canceled[path] = struct{}{}
+}
+
+// Stop stops copying. If graceful, files being copied are finished and others are not started,
+// they keep pending in report, so copying can be continued by ResumeFromReport.
+// Otherwise all stages are aborted at once, like canceling the context.
+func (c *Copyer) Stop(graceful bool) {
+	c.ctrl.lock.Lock()
+	submit := func() {}
+	if !c.ctrl.stopping {
+		c.ctrl.stopping = true
+		if c.ctrl.paused {
+			c.ctrl.paused = false
+			close(c.ctrl.resumed)
+		}
+		submit = c.submitState(StateStopping)
+	}
+	if !graceful && c.ctrl.cancel != nil {
+		c.ctrl.cancel()
+	}
+	c.ctrl.lock.Unlock()
+
+	submit()
+}
+
+// submitState should be called with lock of control held, it returns a func which submits the state change
+// after lock is released, so event handler can call Pause and Resume. Events are dropped after copyer is finished.
+func (c *Copyer) submitState(state string) func() {
+	if c.ctrl.closed {
+		return func() {}
+	}
+
+	c.ctrl.submitting.Add(1)
+	return func() {
+		defer c.ctrl.submitting.Done()
+		c.submit(&EventStateChange{State: state})
+	}
+}
+
+// submitControl submits event unless copyer is finished.
+func (c *Copyer) submitControl(e Event) {
+	c.ctrl.lock.Lock()
+	if c.ctrl.closed {
+		c.ctrl.lock.Unlock()
+		return
+	}
+	c.ctrl.submitting.Add(1)
+	c.ctrl.lock.Unlock()
+
+	defer c.ctrl.submitting.Done()
+	c.submit(e)
+}
+
+// closeEvents closes event channel after events being submitted, state changes after it are not submitted.
+func (c *Copyer) closeEvents() {
+	c.ctrl.lock.Lock()
+	c.ctrl.closed = true
+	c.ctrl.lock.Unlock()
+
+	c.ctrl.submitting.Wait()
+	close(c.eventCh)
+}
+
+func (c *Copyer) isStopping() bool {
+	c.ctrl.lock.Lock()
+	defer c.ctrl.lock.Unlock()
+	return c.ctrl.stopping
+}
+
+// waitControl blocks while copyer is paused, returns error if the job is canceled.
+func (c *Copyer) waitControl(ctx context.Context, job *baseJob) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		c.ctrl.lock.Lock()
+		_, canceled := c.ctrl.canceled[job.path]
+		paused, resumed := c.ctrl.paused, c.ctrl.resumed
+		c.ctrl.lock.Unlock()
+
+		if canceled {
+			return ErrJobCanceled
+		}
+		if !paused {
+			return nil
+		}
+
+		select {
+		case <-resumed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
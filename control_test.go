@@ -0,0 +1,232 @@
+package acp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newControlTest creates a paused copyer with 4 files of 3 chunks, and waits until they are indexed.
+func newControlTest(t *testing.T) (c *Copyer, src, dst string, getter ReportGetter, states func() []string) {
+	t.Helper()
+
+	root := t.TempDir()
+	src, dst = filepath.Join(root, "src"), filepath.Join(root, "dst")
+	mkdirTest(t, dst)
+	for idx := 0; idx < 4; idx++ {
+		writeTestFile(t, filepath.Join(src, fmt.Sprintf("%d.bin", idx)), string(bytes.Repeat([]byte{byte('a' + idx)}, 3*batchSize)))
+	}
+
+	var lock sync.Mutex
+	var changes []string
+	handler, getter := NewReportGetter()
+	onIndexed, indexed := indexedHandler()
+	c, err := New(context.Background(), WildcardJob(Source(src), Target(dst)), WithEventHandler(handler), WithEventHandler(onIndexed), WithEventHandler(func(ev Event) {
+		if e, ok := ev.(*EventStateChange); ok {
+			lock.Lock()
+			changes = append(changes, e.State)
+			lock.Unlock()
+		}
+	}))
+	if err != nil {
+		t.Fatalf("new copyer: %v", err)
+	}
+	c.Pause()
+	waitIndexed(t, indexed)
+
+	return c, src, dst, getter, func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]string(nil), changes...)
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	c, _, dst, getter, states := newControlTest(t)
+
+	// indexed jobs are given time to be copied, if pause does not work
+	time.Sleep(100 * time.Millisecond)
+	var files int
+	for _, job := range getter().Jobs {
+		if job.Status == JobStatusFinished {
+			t.Fatalf("job is finished while paused: %+v", job)
+		}
+		if !job.Mode.IsDir() {
+			files++
+		}
+	}
+	if files != 4 {
+		t.Fatalf("unexpected indexed jobs: %d", files)
+	}
+
+	c.Resume()
+	c.Wait()
+
+	report := getter()
+	if len(report.Errors) > 0 {
+		t.Fatalf("unexpected errors: %v", report.Errors[0])
+	}
+	for idx := 0; idx < 4; idx++ {
+		fi, err := os.Stat(filepath.Join(dst, "src", fmt.Sprintf("%d.bin", idx)))
+		if err != nil || fi.Size() != 3*batchSize {
+			t.Fatalf("unexpected target: %v, %v", fi, err)
+		}
+	}
+	if got := fmt.Sprint(states()); got != fmt.Sprint([]string{StatePaused, StateRunning}) {
+		t.Fatalf("unexpected state changes: %s", got)
+	}
+
+	// control after finished is ignored
+	c.Pause()
+	c.Stop(false)
+}
+
+func TestCancelJob(t *testing.T) {
+	c, src, dst, getter, _ := newControlTest(t)
+
+	canceled := filepath.Join(src, "1.bin")
+	c.CancelJob(canceled)
+	c.Resume()
+	c.Wait()
+
+	for _, job := range getter().Jobs {
+		if job.Mode.IsDir() {
+			continue
+		}
+
+		target := filepath.Join(dst, job.Path)
+		if job.FullPath != canceled {
+			if len(job.SuccessTargets) != 1 {
+				t.Fatalf("unexpected job: %+v", job)
+			}
+			continue
+		}
+
+		if len(job.SuccessTargets) != 0 || !strings.Contains(fmt.Sprint(job.FailTargets[target]), ErrJobCanceled.Error()) {
+			t.Fatalf("unexpected canceled job: %+v", job)
+		}
+		if _, err := os.Stat(target); !os.IsNotExist(err) {
+			t.Fatalf("target of canceled job is not deleted, %v", err)
+		}
+	}
+}
+
+func TestStopGraceful(t *testing.T) {
+	c, _, _, getter, states := newControlTest(t)
+
+	c.Stop(true)
+	done := make(chan struct{})
+	go func() {
+		c.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("copyer is not stopped")
+	}
+
+	var pending int
+	for _, job := range getter().Jobs {
+		if len(job.FailTargets) > 0 {
+			t.Fatalf("unexpected failed job: %+v", job)
+		}
+		switch job.Status {
+		case JobStatusPending:
+			pending++
+		case JobStatusFinished:
+			if len(job.SuccessTargets) != 1 {
+				t.Fatalf("unexpected finished job: %+v", job)
+			}
+		}
+	}
+	if pending == 0 {
+		t.Fatalf("no job is kept pending")
+	}
+	if got := fmt.Sprint(states()); got != fmt.Sprint([]string{StatePaused, StateStopping}) {
+		t.Fatalf("unexpected state changes: %s", got)
+	}
+}
+
+func TestCancelJobWhileCopying(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "a.bin"), filepath.Join(root, "dst.bin")
+	writeTestFile(t, src, string(bytes.Repeat([]byte{'a'}, 4*batchSize)))
+
+	copying := make(chan struct{})
+	var once sync.Once
+	handler, getter := NewReportGetter()
+	c, err := New(context.Background(), AccurateJob(src, []string{dst}), SetFromDevice(DeviceBandwidth(2*batchSize)),
+		WithEventHandler(handler), WithEventHandler(func(ev Event) {
+			if e, ok := ev.(*EventUpdateJob); ok && e.Job.Status == JobStatusCopying {
+				once.Do(func() { close(copying) })
+			}
+		}))
+	if err != nil {
+		t.Fatalf("new copyer: %v", err)
+	}
+
+	<-copying
+	c.CancelJob(src)
+	c.Wait()
+
+	job := getter().Jobs[0]
+	if len(job.SuccessTargets) != 0 || !strings.Contains(fmt.Sprint(job.FailTargets[dst]), ErrJobCanceled.Error()) {
+		t.Fatalf("unexpected canceled job: %+v", job)
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Fatalf("partial target is not deleted, %v", err)
+	}
+}
+
+func TestControlSubmitOutOfLock(t *testing.T) {
+	c := &Copyer{eventCh: make(chan Event)}
+	paused := make(chan struct{})
+	go func() {
+		c.Pause()
+		close(paused)
+	}()
+
+	// control is not locked while the state change is being submitted
+	checked := make(chan struct{})
+	go func() {
+		defer close(checked)
+		for {
+			c.ctrl.lock.Lock()
+			paused := c.ctrl.paused
+			c.ctrl.lock.Unlock()
+			if paused {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	select {
+	case <-checked:
+	case <-time.After(time.Second):
+		t.Fatalf("control is locked while submitting")
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		c.closeEvents()
+		close(closed)
+	}()
+	if e, ok := (<-c.eventCh).(*EventStateChange); !ok || e.State != StatePaused {
+		t.Fatalf("unexpected event: %+v", e)
+	}
+	<-paused
+	<-closed
+	if e, ok := <-c.eventCh; ok {
+		t.Fatalf("unexpected event after closed: %+v", e)
+	}
+
+	// state changes after closed are dropped
+	c.Resume()
+}
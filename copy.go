@@ -4,16 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"hash"
 	"io"
 	"os"
 	"path"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	mapset "github.com/deckarep/golang-set/v2"
-	sha256 "github.com/minio/sha256-simd"
 	"github.com/samber/lo"
 )
 
@@ -21,33 +20,37 @@ const (
 	batchSize = 1 * 1024 * 1024
 )
 
-var (
-	sha256Pool = &sync.Pool{New: func() interface{} { return sha256.New() }}
-)
-
 func (c *Copyer) copy(ctx context.Context, prepared <-chan *writeJob) <-chan *baseJob {
 	ch := make(chan *baseJob, 128)
 
-	var copying sync.WaitGroup
-	done := make(chan struct{})
+	var copying, finishing sync.WaitGroup
+	workers := &deviceWorkers{devices: make(map[string]*targetDevice)}
+	done, exited := make(chan struct{}), make(chan struct{})
 	defer func() {
 		go wrap(ctx, func() {
-			defer close(done)
 			defer close(ch)
 
+			// retried jobs are written by workers, so workers are closed after all jobs are finished
 			copying.Wait()
+			finishing.Wait()
+			workers.close()
+			close(done)
+			<-exited
 		})
 	}()
 
 	cntr := new(counter)
 	go wrap(ctx, func() {
+		defer close(exited)
+
 		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
 		for {
 			select {
 			case <-ticker.C:
-				c.submit(&EventUpdateProgress{Bytes: atomic.LoadInt64(&cntr.bytes), Files: atomic.LoadInt64(&cntr.files)})
+				c.submit(&EventUpdateProgress{Bytes: atomic.LoadInt64(&cntr.bytes), Files: atomic.LoadInt64(&cntr.files), PhysicalBytes: atomic.LoadInt64(&cntr.physical)})
 			case <-done:
-				c.submit(&EventUpdateProgress{Bytes: atomic.LoadInt64(&cntr.bytes), Files: atomic.LoadInt64(&cntr.files), Finished: true})
+				c.submit(&EventUpdateProgress{Bytes: atomic.LoadInt64(&cntr.bytes), Files: atomic.LoadInt64(&cntr.files), PhysicalBytes: atomic.LoadInt64(&cntr.physical), Finished: true})
 				return
 			}
 		}
@@ -67,8 +70,14 @@ func (c *Copyer) copy(ctx context.Context, prepared <-chan *writeJob) <-chan *ba
 					if !ok {
 						return
 					}
+					// prepared jobs are not started after stopping
+					if c.isStopping() {
+						job.setStatus(jobStatusPending)
+						job.done()
+						continue
+					}
 
-					wrap(ctx, func() { c.write(ctx, job, ch, cntr, noSpaceDevices) })
+					wrap(ctx, func() { c.write(ctx, job, ch, cntr, workers, &finishing, noSpaceDevices) })
 				}
 			}
 		})
@@ -77,48 +86,104 @@ func (c *Copyer) copy(ctx context.Context, prepared <-chan *writeJob) <-chan *ba
 	return ch
 }
 
-func (c *Copyer) write(ctx context.Context, job *writeJob, ch chan<- *baseJob, cntr *counter, noSpaceDevices mapset.Set[string]) {
+// write reads the job once and sends it to all targets, it returns after the job is read,
+// targets on slow devices may be still writing, the job is sent to ch after all are finished.
+func (c *Copyer) write(ctx context.Context, job *writeJob, ch chan<- *baseJob, cntr *counter, workers *deviceWorkers, finishing *sync.WaitGroup, noSpaceDevices mapset.Set[string]) {
+	// sources opened by openSource are counted at open
+	if job.stream != nil || !job.hasData() {
+		job.addAttempt()
+	}
 	job.setStatus(jobStatusCopying)
-	defer job.setStatus(jobStatusFinishing)
+
+	// archive member is written at the first try only
+	retry := job.retryTargets != nil
+	targets := job.writeTargets()
+	// devices changed media after it are not asked for media again
+	since := c.mediaSeq()
 
 	var wg sync.WaitGroup
+	// members of archive are written one by one, so the next job waits for the archive
+	var archived chan struct{}
+	finishing.Add(1)
 	defer func() {
-		wg.Wait()
+		if archived != nil {
+			<-archived
+		}
 		job.done()
-		ch <- job.baseJob
+		go wrap(ctx, func() {
+			defer finishing.Done()
+
+			wg.Wait()
+			if c.retryJob(ctx, job, since, ch, workers, finishing, noSpaceDevices) {
+				return
+			}
+
+			job.setStatus(jobStatusFinishing)
+			ch <- job.baseJob
+		})
 	}()
 
-	// shortcut
-	if noSpaceDevices.Contains(lo.Map(job.targets, func(target string, _ int) string { return c.getDevice(target) })...) {
+	// shortcut, full devices may get new media by handler
+	if len(targets) > 0 && (c.archive == nil || retry) && c.mediaHandler == nil && noSpaceDevices.Contains(lo.Map(targets, func(target string, _ int) string { return c.getDevice(target) })...) {
 		job.fail("", ErrTargetNoSpace)
 		return
 	}
 
-	atomic.AddInt64(&cntr.files, 1)
-	chans := make([]chan []byte, 0, len(job.targets)+1)
+	if !retry {
+		atomic.AddInt64(&cntr.files, 1)
+	}
+	if c.archive != nil && !retry && !job.hasData() {
+		c.writeArchiveMeta(job.baseJob)
+	}
+	if job.linkTo != nil {
+		// hard links are created at cleanup, after the linked job is finished
+		return
+	}
+	// space of span target is checked when its volume is chosen
+	var spanned string
+	if job.span != nil && !retry && job.getVolume() == "" {
+		if !c.spanTarget(job, noSpaceDevices) {
+			return
+		}
+		targets, spanned = job.writeTargets(), job.src.dst(job.getVolume())
+	}
+	if !job.stat.mode.IsRegular() {
+		c.writeSpecial(job, noSpaceDevices)
+		return
+	}
+
+	var readErr error
+	// targets cloned by reflink, are finished after source is hashed
+	cloned := make([]string, 0)
+	defer func() {
+		for _, target := range cloned {
+			if readErr != nil {
+				job.fail(target, fmt.Errorf("hash src file fail, %w", readErr))
+				continue
+			}
+			job.success(target)
+		}
+	}()
+
+	chans := make([]chan *chunk, 0, len(targets)+1)
 	defer func() {
 		for _, ch := range chans {
 			close(ch)
 		}
 	}()
 
-	var readErr error
-	for _, target := range job.targets {
+	// targets are grouped by device, each device writes its targets by its own workers
+	tasks := make(map[string]*deviceTask)
+
+	for _, target := range targets {
 		target := target
 
 		dev := c.getDevice(target)
-		if noSpaceDevices.Contains(dev) {
-			job.fail(target, ErrTargetNoSpace)
-			continue
-		}
-
-		if err := c.getDiskUsageCache(dev).check(job.size); err != nil {
-			if errors.Is(err, ErrTargetNoSpace) {
-				noSpaceDevices.Add(dev)
+		if target != spanned {
+			if err := c.checkTargetSpace(ctx, job, target, dev, since, noSpaceDevices); err != nil {
+				job.fail(target, err)
+				continue
 			}
-
-			job.fail(target, fmt.Errorf("check disk usage have error, %w", err))
-			continue
 		}
 
 		if err := mappingError(os.MkdirAll(path.Dir(target), os.ModePerm)); err != nil {
@@ -130,7 +195,14 @@ func (c *Copyer) write(ctx context.Context, job *writeJob, ch chan<- *baseJob, c
 			continue
 		}
 
-		file, err := os.OpenFile(target, c.createFlag, job.stat.mode)
+		dstPath := target
+		var file *os.File
+		var err error
+		if c.atomicWrite {
+			file, dstPath, err = c.openAtomic(job, target)
+		} else {
+			file, err = os.OpenFile(target, c.createFlag, job.stat.mode)
+		}
 		if err = mappingError(err); err != nil {
 			if checkErrorAbort(err) {
 				noSpaceDevices.Add(dev)
@@ -139,93 +211,174 @@ func (c *Copyer) write(ctx context.Context, job *writeJob, ch chan<- *baseJob, c
 			job.fail(target, fmt.Errorf("open dst file fail, %w", err))
 			continue
 		}
-		if !job.copyer.toDevice.linear {
-			if err := truncate(file, job.size); err != nil {
-				job.fail(target, fmt.Errorf("truncate dst file fail, %w", err))
+		if c.reflink != ReflinkNever && job.stream == nil {
+			ok, err := c.reflinkTarget(job, file, dev)
+			if err != nil {
+				file.Close()
+				if err := os.Remove(dstPath); err != nil {
+					c.reportError(job.path, target, fmt.Errorf("delete failed file has error, %w", err))
+				}
+
+				job.fail(target, fmt.Errorf("reflink dst file fail, %w", mappingError(err)))
+				continue
+			}
+			if ok {
+				file.Close()
+				cloned = append(cloned, target)
 				continue
 			}
 		}
+		devOpt := c.deviceOption(dev)
+		if !devOpt.linear {
+			// sparse targets are not preallocated, holes are left by seeking over them
+			truncateFile := truncate
+			if job.extents != nil {
+				truncateFile = func(file *os.File, size int64) error { return file.Truncate(size) }
+			}
 
-		ch := make(chan []byte, 4)
-		chans = append(chans, ch)
-
-		wg.Add(1)
-		go wrap(ctx, func() {
-			defer wg.Done()
-
-			var rerr error
-			defer func() {
-				if rerr == nil {
-					job.success(target)
-					return
-				}
-
-				// avoid block channel
-				for range ch {
-				}
-
-				if err := os.Remove(target); err != nil {
+			if err := truncateFile(file, job.size); err != nil {
+				file.Close()
+				if err := os.Remove(dstPath); err != nil {
 					c.reportError(job.path, target, fmt.Errorf("delete failed file has error, %w", err))
 				}
 
-				rerr = mappingError(rerr)
-				if checkErrorAbort(rerr) {
-					noSpaceDevices.Add(dev)
-				}
+				job.fail(target, fmt.Errorf("truncate dst file fail, %w", mappingError(err)))
+				continue
+			}
+		}
 
-				job.fail(target, fmt.Errorf("write dst file fail, %w", rerr))
-			}()
+		task, has := tasks[dev]
+		if !has {
+			task = &deviceTask{job: job, dev: dev, ch: make(chan *chunk, devOpt.bufferChunks()), wg: &wg, readErr: &readErr}
+			tasks[dev] = task
+		}
+		task.files = append(task.files, &targetFile{target: target, path: dstPath, file: file})
+	}
 
-			defer file.Close()
-			for buf := range ch {
-				n, err := file.Write(buf)
-				if err != nil {
-					rerr = fmt.Errorf("write fail, %w", err)
-					return
-				}
-				if len(buf) != n {
-					rerr = fmt.Errorf("write fail, unexpected writen bytes return, read= %d write= %d", len(buf), n)
-					return
-				}
-			}
+	// submit in the same device order in all readers, so they will not wait for each other
+	devs := lo.Keys(tasks)
+	sort.Strings(devs)
+	for _, dev := range devs {
+		task := tasks[dev]
+		wg.Add(1)
+		if err := c.targetDevice(ctx, workers, dev, noSpaceDevices).submit(ctx, task); err != nil {
+			wg.Done()
+			c.abortTask(task, err)
+			continue
+		}
+		chans = append(chans, task.ch)
+	}
 
-			if err := file.Sync(); err != nil {
-				rerr = fmt.Errorf("sync dst file fail, %w", err)
-				return
-			}
-			if readErr != nil {
-				rerr = readErr
-				return
-			}
+	if c.archive != nil && !retry {
+		ch := make(chan *chunk, 4)
+		chans = append(chans, ch)
+
+		archived = make(chan struct{})
+		go wrap(ctx, func() {
+			defer close(archived)
+			c.writeArchiveData(ctx, job, ch, &readErr)
 		})
 	}
 	if len(chans) == 0 {
-		return
+		if len(cloned) == 0 {
+			return
+		}
+		if len(c.hashes) == 0 {
+			atomic.AddInt64(&cntr.bytes, job.size)
+			return
+		}
 	}
 
-	if c.withHash {
-		sha := sha256Pool.Get().(hash.Hash)
-		sha.Reset()
+	for _, name := range c.hashes {
+		name := name
+		h := getHasher(name)
 
-		ch := make(chan []byte, 4)
+		ch := make(chan *chunk, 4)
 		chans = append(chans, ch)
 
 		wg.Add(1)
 		go wrap(ctx, func() {
 			defer wg.Done()
-			defer sha256Pool.Put(sha)
+			defer putHasher(name, h)
 
-			for buf := range ch {
-				sha.Write(buf)
+			for chk := range ch {
+				if chk.hole > 0 {
+					writeZero(h, chk.hole)
+					continue
+				}
+				h.Write(chk.data)
 			}
 
-			job.setHash(sha.Sum(nil))
+			job.setHash(name, h.Sum(nil))
 		})
 	}
-	readErr = c.streamCopy(ctx, chans, job.reader, &cntr.bytes)
+	readErr = c.streamCopy(ctx, job.baseJob, chans, job.reader, job.size, job.extents, cntr)
 }
 
-func (c *Copyer) streamCopy(ctx context.Context, dsts []chan []byte, src io.ReadCloser, bytes *int64) error {
+// checkTargetSpace checks free space of target device, waits for new media if the device is full.
+// Files which do not fit the new media are failed without asking for media again.
+func (c *Copyer) checkTargetSpace(ctx context.Context, job *writeJob, target, dev string, since int, noSpaceDevices mapset.Set[string]) error {
+	check := func() error {
+		// full devices may be marked by writes on the old media, so disk usage is always checked with handler
+		if c.mediaHandler == nil && noSpaceDevices.Contains(dev) {
+			return ErrTargetNoSpace
+		}
+		if err := c.getDiskUsageCache(dev).check(physicalSize(job.size, job.extents)); err != nil {
+			if errors.Is(err, ErrTargetNoSpace) {
+				noSpaceDevices.Add(dev)
+			}
+			return fmt.Errorf("check disk usage have error, %w", err)
+		}
+		return nil
+	}
+
+	err := check()
+	if err == nil || c.mediaHandler == nil || !errors.Is(err, ErrTargetNoSpace) {
+		return err
+	}
+	if c.needMedia(ctx, dev, target, err, since, noSpaceDevices) != nil {
+		return err
+	}
+	return check()
+}
+
+// streamCopy reads src and sends it to dsts, only data extents are read if extents is not nil.
+func (c *Copyer) streamCopy(ctx context.Context, job *baseJob, dsts []chan *chunk, src io.ReadCloser, size int64, extents []extent, cntr *counter) error {
+	// empty file
+	if src == nil && size == 0 {
+		return nil
+	}
+
+	readerAt, ok := src.(io.ReaderAt)
+	if extents == nil || !ok {
+		return c.streamRead(ctx, job, dsts, src, cntr)
+	}
+
+	var offset int64
+	for _, e := range extents {
+		if e.offset > offset {
+			c.sendHole(dsts, e.offset-offset, cntr)
+		}
+		if err := c.streamRead(ctx, job, dsts, io.NewSectionReader(readerAt, e.offset, e.length), cntr); err != nil {
+			return err
+		}
+		offset = e.offset + e.length
+	}
+	if size > offset {
+		c.sendHole(dsts, size-offset, cntr)
+	}
+	return nil
+}
+
+func (c *Copyer) sendHole(dsts []chan *chunk, n int64, cntr *counter) {
+	chk := &chunk{hole: n}
+	for _, ch := range dsts {
+		ch <- chk
+	}
+	atomic.AddInt64(&cntr.bytes, n)
+}
+
+func (c *Copyer) streamRead(ctx context.Context, job *baseJob, dsts []chan *chunk, src io.Reader, cntr *counter) error {
 	for idx := int64(0); ; idx += batchSize {
 		buf := make([]byte, batchSize)
 
@@ -236,21 +389,32 @@ func (c *Copyer) streamCopy(ctx context.Context, dsts []chan []byte, src io.Read
 			}
 		}
 
-		buf = buf[:n]
+		chk := &chunk{data: buf[:n]}
 		for _, ch := range dsts {
-			ch <- buf
+			ch <- chk
 		}
 
-		nr := len(buf)
-		atomic.AddInt64(bytes, int64(nr))
+		nr := int64(n)
+		atomic.AddInt64(&cntr.bytes, nr)
+		atomic.AddInt64(&cntr.physical, nr)
+		if err := c.fromLimiter.wait(ctx, nr); err != nil {
+			return err
+		}
 		if nr < batchSize {
 			return nil
 		}
 
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
+		// paused or canceled after the current buffer
+		if err := c.waitControl(ctx, job); err != nil {
+			return err
 		}
 	}
 }
+
+// writeHole leaves a hole on target, linear devices cannot seek, so zeros are written.
+func writeHole(file *os.File, offset, n int64, linear bool) error {
+	if linear {
+		return writeZero(file, n)
+	}
+	return skipHole(file, offset, n)
+}
@@ -0,0 +1,185 @@
+package acp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+// targetDevice is a target mount point, files on it are written by its own workers,
+// so a slow device only blocks the reader after its buffer is full.
+type targetDevice struct {
+	name    string
+	opt     *deviceOption
+	limiter *bandwidthLimiter
+	queue   chan *deviceTask
+}
+
+// deviceTask writes one job into all its targets on one device.
+type deviceTask struct {
+	job     *writeJob
+	dev     string
+	files   []*targetFile
+	ch      chan *chunk
+	wg      *sync.WaitGroup
+	readErr *error
+}
+
+type targetFile struct {
+	target string
+	path   string // path written, differs from target when atomic write is enabled
+	file   *os.File
+	offset int64
+	err    error
+}
+
+type deviceWorkers struct {
+	lock    sync.Mutex
+	wg      sync.WaitGroup
+	devices map[string]*targetDevice
+}
+
+// targetDevice returns the device by mount point, its workers are started at the first call.
+func (c *Copyer) targetDevice(ctx context.Context, workers *deviceWorkers, name string, noSpaceDevices mapset.Set[string]) *targetDevice {
+	workers.lock.Lock()
+	defer workers.lock.Unlock()
+
+	if dev, has := workers.devices[name]; has {
+		return dev
+	}
+
+	opt := c.deviceOption(name)
+	dev := &targetDevice{name: name, opt: opt, limiter: c.deviceLimiters[path.Clean(name)], queue: make(chan *deviceTask)}
+	workers.devices[name] = dev
+
+	for idx := 0; idx < opt.threads; idx++ {
+		workers.wg.Add(1)
+		go wrap(ctx, func() {
+			defer workers.wg.Done()
+			for task := range dev.queue {
+				c.writeTask(ctx, dev, task, noSpaceDevices)
+			}
+		})
+	}
+	return dev
+}
+
+// close stops workers after all queued tasks are finished.
+func (w *deviceWorkers) close() {
+	w.lock.Lock()
+	for _, dev := range w.devices {
+		close(dev.queue)
+	}
+	w.lock.Unlock()
+
+	w.wg.Wait()
+}
+
+// submit waits for a free worker of the device, tasks of one job should be submitted
+// in the same device order by all readers, or readers may wait for each other.
+func (d *targetDevice) submit(ctx context.Context, task *deviceTask) error {
+	select {
+	case d.queue <- task:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// abortTask fails all targets of a task which is not submitted.
+func (c *Copyer) abortTask(task *deviceTask, err error) {
+	for _, f := range task.files {
+		f.file.Close()
+		if rerr := os.Remove(f.path); rerr != nil {
+			c.reportError(task.job.path, f.target, fmt.Errorf("delete failed file has error, %w", rerr))
+		}
+		task.job.fail(f.target, fmt.Errorf("write dst file fail, %w", err))
+	}
+}
+
+func (c *Copyer) writeTask(ctx context.Context, dev *targetDevice, task *deviceTask, noSpaceDevices mapset.Set[string]) {
+	defer task.wg.Done()
+
+	job := task.job
+	setErr := func(err error) {
+		for _, f := range task.files {
+			if f.err == nil {
+				f.err = err
+			}
+		}
+	}
+
+	for chk := range task.ch {
+		// holes are written as zeros on linear devices, every live file of task is charged
+		if chk.hole == 0 || dev.opt.linear {
+			var live int64
+			for _, f := range task.files {
+				if f.err == nil {
+					live++
+				}
+			}
+			if err := c.toLimiter.wait(ctx, chk.len()*live); err != nil {
+				setErr(err)
+			}
+			if err := dev.limiter.wait(ctx, chk.len()*live); err != nil {
+				setErr(err)
+			}
+		}
+
+		for _, f := range task.files {
+			if f.err != nil {
+				continue
+			}
+			if chk.hole > 0 {
+				if err := writeHole(f.file, f.offset, chk.hole, dev.opt.linear); err != nil {
+					f.err = fmt.Errorf("write hole fail, %w", err)
+				}
+				f.offset += chk.hole
+				continue
+			}
+
+			buf := chk.data
+			n, err := f.file.Write(buf)
+			if err != nil {
+				f.err = fmt.Errorf("write fail, %w", err)
+				continue
+			}
+			if len(buf) != n {
+				f.err = fmt.Errorf("write fail, unexpected writen bytes return, read= %d write= %d", len(buf), n)
+				continue
+			}
+			f.offset += int64(n)
+		}
+	}
+
+	for _, f := range task.files {
+		if f.err == nil {
+			if err := f.file.Sync(); err != nil {
+				f.err = fmt.Errorf("sync dst file fail, %w", err)
+			}
+		}
+		f.file.Close()
+		if f.err == nil && *task.readErr != nil {
+			f.err = *task.readErr
+		}
+
+		if f.err == nil {
+			job.success(f.target)
+			continue
+		}
+
+		if err := os.Remove(f.path); err != nil {
+			c.reportError(job.path, f.target, fmt.Errorf("delete failed file has error, %w", err))
+		}
+
+		rerr := mappingError(f.err)
+		if checkErrorAbort(rerr) {
+			noSpaceDevices.Add(task.dev)
+		}
+		job.fail(f.target, fmt.Errorf("write dst file fail, %w", rerr))
+	}
+}
@@ -0,0 +1,136 @@
+package acp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTargetDeviceLinear(t *testing.T) {
+	root := t.TempDir()
+	src, dst1, dst2 := filepath.Join(root, "src"), filepath.Join(root, "dst1"), filepath.Join(root, "dst2")
+	mkdirTest(t, dst1, dst2)
+
+	files := make(map[string][]byte)
+	for idx := 0; idx < 4; idx++ {
+		name := fmt.Sprintf("%d.bin", idx)
+		files[name] = bytes.Repeat([]byte{byte('a' + idx)}, idx*batchSize+idx)
+		writeTestFile(t, filepath.Join(src, name), string(files[name]))
+	}
+
+	getDevice, err := getMountpointCache()
+	if err != nil {
+		t.Fatalf("get mount points: %v", err)
+	}
+
+	// both targets are on the same device, which has only one worker and the smallest buffer
+	report := runCopyer(t, WildcardJob(Source(src), Target(dst1, dst2)),
+		SetTargetDevice(getDevice(root), LinearDevice(true), DeviceBuffer(1)))
+	if len(report.Errors) > 0 {
+		t.Fatalf("unexpected errors: %v", report.Errors[0])
+	}
+
+	for _, dst := range []string{dst1, dst2} {
+		for name, want := range files {
+			got, err := os.ReadFile(filepath.Join(dst, "src", name))
+			if err != nil || !bytes.Equal(got, want) {
+				t.Fatalf("unexpected target %s, len= %d, err= %v", name, len(got), err)
+			}
+		}
+	}
+}
+
+func TestTargetDeviceLinearOrder(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "src"), filepath.Join(root, "dst")
+	for idx := 0; idx < 64; idx++ {
+		writeTestFile(t, filepath.Join(src, fmt.Sprintf("%02d.txt", idx)), fmt.Sprint(idx))
+	}
+	writeTestFile(t, filepath.Join(dst, ".keep"), "")
+
+	getDevice, err := getMountpointCache()
+	if err != nil {
+		t.Fatalf("get mount points: %v", err)
+	}
+
+	// only the target device is linear, files are still written in sorted order
+	report := runCopyer(t, WildcardJob(Source(src), Target(dst)), SetTargetDevice(getDevice(root), LinearDevice(true)))
+	if len(report.Errors) > 0 {
+		t.Fatalf("unexpected errors: %v", report.Errors[0])
+	}
+
+	var last *Job
+	for idx := 0; idx < 64; idx++ {
+		job := findReportJob(report, filepath.Join("src", fmt.Sprintf("%02d.txt", idx)))
+		if job == nil || job.WriteTime.IsZero() {
+			t.Fatalf("unexpected job %d: %+v", idx, job)
+		}
+		if last != nil && job.WriteTime.Before(last.WriteTime) {
+			t.Fatalf("unexpected write order, '%s' is written before '%s'", job.Path, last.Path)
+		}
+		last = job
+	}
+}
+
+func TestTargetDeviceNotBlocked(t *testing.T) {
+	getDevice, err := getMountpointCache()
+	if err != nil {
+		t.Fatalf("get mount points: %v", err)
+	}
+
+	root := t.TempDir()
+	fastRoot, err := os.MkdirTemp("/dev/shm", "acp-test")
+	if err != nil {
+		t.Skipf("no tmpfs at /dev/shm, %s", err)
+	}
+	defer os.RemoveAll(fastRoot)
+	if getDevice(root) == getDevice(fastRoot) {
+		t.Skipf("/dev/shm is on the same device of temp dir")
+	}
+
+	src, slow, fast := filepath.Join(root, "src"), filepath.Join(root, "slow"), filepath.Join(fastRoot, "fast")
+	mkdirTest(t, slow, fast)
+
+	data := bytes.Repeat([]byte{'a'}, batchSize)
+	for idx := 0; idx < 3; idx++ {
+		writeTestFile(t, filepath.Join(src, fmt.Sprintf("%d.bin", idx)), string(data))
+	}
+
+	start := time.Now()
+	handler, getter := NewReportGetter()
+	c, err := New(context.Background(), WildcardJob(Source(src), Target(slow, fast)), WithEventHandler(handler),
+		SetTargetDevice(getDevice(root), DeviceBandwidth(batchSize)))
+	if err != nil {
+		t.Fatalf("new copyer: %v", err)
+	}
+
+	var fastElapsed time.Duration
+	for fastElapsed == 0 && time.Since(start) < 10*time.Second {
+		finished := true
+		for idx := 0; idx < 3; idx++ {
+			got, _ := os.ReadFile(filepath.Join(fast, "src", fmt.Sprintf("%d.bin", idx)))
+			finished = finished && bytes.Equal(got, data)
+		}
+		if finished {
+			fastElapsed = time.Since(start)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Wait()
+	elapsed := time.Since(start)
+
+	if report := getter(); len(report.Errors) > 0 {
+		t.Fatalf("unexpected errors: %v", report.Errors[0])
+	}
+	// slow device writes 1MB per second, first chunk is written at once
+	if elapsed < 1500*time.Millisecond {
+		t.Fatalf("slow device is not limited, elapsed= %s", elapsed)
+	}
+	if fastElapsed == 0 || fastElapsed > elapsed/2 {
+		t.Fatalf("fast device is blocked by slow device, fast= %s, all= %s", fastElapsed, elapsed)
+	}
+}
@@ -21,6 +21,11 @@ var (
 		{from: syscall.ENOSPC, to: ErrTargetNoSpace},
 		{from: syscall.EROFS, to: ErrTargetDropToReadonly},
 		{from: syscall.EIO, to: ErrTargetDropToReadonly},
+		{from: syscall.EAGAIN, to: ErrTransient},
+		{from: syscall.EINTR, to: ErrTransient},
+		{from: syscall.ETIMEDOUT, to: ErrTransient},
+		{from: syscall.ESTALE, to: ErrTransient},
+		{from: syscall.ECONNRESET, to: ErrTransient},
 	}
 	abortErrors = []error{
 		ErrTargetNoSpace,
@@ -72,6 +77,20 @@ func (m *diskUsageCache) check(need int64) error {
 	return nil
 }
 
+// available returns the free space of device, the cache is refreshed.
+func (m *diskUsageCache) available() (int64, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	usage, err := godf.NewDiskUsage(m.mountPoint)
+	if err != nil {
+		return 0, fmt.Errorf("get disk usage fail, mount_point= %s, %w", m.mountPoint, err)
+	}
+
+	m.freeSpace, m.used = usage.Available(), 0
+	return m.freeSpace, nil
+}
+
 func mappingError(err error) error {
 	if err == nil {
 		return nil
@@ -8,6 +8,7 @@ type Event interface {
 
 type EventUpdateCount struct {
 	Bytes, Files int64
+	Skipped      int64
 	Finished     bool
 }
 
@@ -15,7 +16,9 @@ func (*EventUpdateCount) iEvent() {}
 
 type EventUpdateProgress struct {
 	Bytes, Files int64
-	Finished     bool
+	// PhysicalBytes is the bytes actually read, holes of sparse files are not included
+	PhysicalBytes int64
+	Finished      bool
 }
 
 func (*EventUpdateProgress) iEvent() {}
@@ -32,6 +35,35 @@ type EventReportError struct {
 
 func (*EventReportError) iEvent() {}
 
+type EventDelete struct {
+	Delete *Delete
+}
+
+func (*EventDelete) iEvent() {}
+
+type EventPlanDevice struct {
+	Device *PlanDevice
+}
+
+func (*EventPlanDevice) iEvent() {}
+
+// EventStateChange is submitted when copyer is paused, resumed or stopping.
+type EventStateChange struct {
+	State string
+}
+
+func (*EventStateChange) iEvent() {}
+
+// EventNeedMedia is submitted when a target device is full or disappears, copying is paused
+// until the media change handler returns.
+type EventNeedMedia struct {
+	Device string
+	Target string
+	Error  error
+}
+
+func (*EventNeedMedia) iEvent() {}
+
 type EventFinished struct{}
 
 func (*EventFinished) iEvent() {}
@@ -0,0 +1,305 @@
+package acp
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// fileFilter filters the entries of wildcard job with gitignore style rules.
+// Paths are matched relative to the walked source root like gitignore, such like `dir/file`
+// for `/data/example/dir/file` of `Source("/data/example")`, or member names of tar source.
+// The source root itself is only matched when it is a file, by its name.
+type fileFilter struct {
+	rules      []*filterRule
+	hasInclude bool
+
+	minSize   int64
+	maxSize   int64
+	newerThan time.Time
+	olderThan time.Time
+}
+
+type filterRule struct {
+	pattern string
+	include bool
+	dirOnly bool
+	regexp  *regexp.Regexp
+	err     error
+
+	// rules will be loaded from file when the job is checked
+	fromFile string
+}
+
+func (f *fileFilter) addPatterns(include bool, patterns ...string) {
+	for _, p := range patterns {
+		rule, ok := newFilterRule(p, include)
+		if !ok {
+			continue
+		}
+		if include && rule.include {
+			f.hasInclude = true
+		}
+		f.rules = append(f.rules, rule)
+	}
+}
+
+func newFilterRule(pattern string, include bool) (*filterRule, bool) {
+	pattern = strings.TrimRight(pattern, " \t\r")
+	if pattern == "" || strings.HasPrefix(pattern, "#") {
+		return nil, false
+	}
+	if strings.HasPrefix(pattern, "!") {
+		pattern, include = pattern[1:], !include
+	}
+
+	rule := &filterRule{pattern: pattern, include: include}
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	expr := globToRegexp(pattern)
+	if !anchored {
+		expr = "(^|.*/)" + expr
+	} else {
+		expr = "^" + expr
+	}
+
+	// pattern which cannot compile is reported when the filter is checked
+	rule.regexp, rule.err = regexp.Compile(expr + "$")
+
+	return rule, true
+}
+
+func globToRegexp(pattern string) string {
+	var buf strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		ch := pattern[i]
+		switch ch {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					i++
+					buf.WriteString("(.*/)?")
+					continue
+				}
+				buf.WriteString(".*")
+				continue
+			}
+			buf.WriteString("[^/]*")
+		case '?':
+			buf.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				buf.WriteString(regexp.QuoteMeta(string(ch)))
+				continue
+			}
+
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			buf.WriteString("[" + class + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				buf.WriteString(regexp.QuoteMeta(string(pattern[i])))
+				continue
+			}
+			buf.WriteString(regexp.QuoteMeta(string(ch)))
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	return buf.String()
+}
+
+func (f *fileFilter) check() error {
+	if f == nil {
+		return nil
+	}
+
+	rules := make([]*filterRule, 0, len(f.rules))
+	for _, rule := range f.rules {
+		if rule.err != nil {
+			return fmt.Errorf("invalid filter pattern '%s', %w", rule.pattern, rule.err)
+		}
+		if rule.fromFile == "" {
+			rules = append(rules, rule)
+			continue
+		}
+
+		loaded, err := loadFilterRules(rule.fromFile, rule.include)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, loaded...)
+	}
+
+	f.rules = rules
+	return nil
+}
+
+func loadFilterRules(path string, include bool) ([]*filterRule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open filter file fail, path= '%s', %w", path, err)
+	}
+	defer file.Close()
+
+	rules := make([]*filterRule, 0, 16)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		rule, ok := newFilterRule(scanner.Text(), include)
+		if !ok {
+			continue
+		}
+		if rule.err != nil {
+			return nil, fmt.Errorf("invalid filter pattern in file, path= '%s', pattern= '%s', %w", path, rule.pattern, rule.err)
+		}
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read filter file fail, path= '%s', %w", path, err)
+	}
+	return rules, nil
+}
+
+// match reports whether the entry should be copied (or walked into, for directories),
+// and whether it is included by an include rule, which is inherited by children of a directory.
+// Rules are not matched by an empty path, which is the walked source root.
+func (f *fileFilter) match(path string, fi fs.FileInfo, included bool) (bool, bool) {
+	if f == nil {
+		return true, included
+	}
+
+	isDir := fi.IsDir()
+	for idx := len(f.rules) - 1; idx >= 0 && path != ""; idx-- {
+		rule := f.rules[idx]
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if !rule.regexp.MatchString(path) {
+			continue
+		}
+
+		if !rule.include {
+			return false, false
+		}
+
+		included = true
+		break
+	}
+	if isDir {
+		return true, included
+	}
+
+	if f.hasInclude && !included {
+		return false, false
+	}
+	if f.minSize > 0 && fi.Size() < f.minSize {
+		return false, false
+	}
+	if f.maxSize > 0 && fi.Size() > f.maxSize {
+		return false, false
+	}
+	if !f.newerThan.IsZero() && !fi.ModTime().After(f.newerThan) {
+		return false, false
+	}
+	if !f.olderThan.IsZero() && !fi.ModTime().Before(f.olderThan) {
+		return false, false
+	}
+	return true, included
+}
+
+// filterPath returns path relative to the walked source root, the root is matched by its name
+// only if it is a file.
+func filterPath(root, p string, isDir bool) string {
+	if p == root {
+		if isDir {
+			return ""
+		}
+		return path.Base(p)
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(p, root), "/")
+}
+
+func (job *wildcardJob) getFilter() *fileFilter {
+	if job.filter == nil {
+		job.filter = new(fileFilter)
+	}
+	return job.filter
+}
+
+// Include only copy files matching one of patterns (gitignore style), directories are always walked
+// unless excluded. Later rules take precedence over earlier ones, whatever include or exclude.
+func Include(patterns ...string) WildcardJobOption {
+	return func(j *wildcardJob) *wildcardJob {
+		j.getFilter().addPatterns(true, patterns...)
+		return j
+	}
+}
+
+// Exclude skip files and directories matching one of patterns (gitignore style).
+// A pattern starting with `!` includes the matched files again.
+func Exclude(patterns ...string) WildcardJobOption {
+	return func(j *wildcardJob) *wildcardJob {
+		j.getFilter().addPatterns(false, patterns...)
+		return j
+	}
+}
+
+// ExcludeFrom read exclude patterns from file, one pattern per line, the file format is like `.gitignore`.
+func ExcludeFrom(paths ...string) WildcardJobOption {
+	return func(j *wildcardJob) *wildcardJob {
+		f := j.getFilter()
+		for _, p := range paths {
+			f.rules = append(f.rules, &filterRule{fromFile: p})
+		}
+		return j
+	}
+}
+
+// MinSize skip files smaller than size bytes.
+func MinSize(size int64) WildcardJobOption {
+	return func(j *wildcardJob) *wildcardJob {
+		j.getFilter().minSize = size
+		return j
+	}
+}
+
+// MaxSize skip files larger than size bytes.
+func MaxSize(size int64) WildcardJobOption {
+	return func(j *wildcardJob) *wildcardJob {
+		j.getFilter().maxSize = size
+		return j
+	}
+}
+
+// NewerThan skip files which are not modified after t.
+func NewerThan(t time.Time) WildcardJobOption {
+	return func(j *wildcardJob) *wildcardJob {
+		j.getFilter().newerThan = t
+		return j
+	}
+}
+
+// OlderThan skip files which are not modified before t.
+func OlderThan(t time.Time) WildcardJobOption {
+	return func(j *wildcardJob) *wildcardJob {
+		j.getFilter().olderThan = t
+		return j
+	}
+}
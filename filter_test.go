@@ -0,0 +1,146 @@
+package acp
+
+import (
+	"io/fs"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testFileInfo struct {
+	fs.FileInfo
+	dir  bool
+	size int64
+	mod  time.Time
+}
+
+func (fi *testFileInfo) IsDir() bool        { return fi.dir }
+func (fi *testFileInfo) Size() int64        { return fi.size }
+func (fi *testFileInfo) ModTime() time.Time { return fi.mod }
+
+func TestFilterMatch(t *testing.T) {
+	job := new(wildcardJob)
+	job = Exclude("*.tmp", "/build", "cache/", "!keep.tmp", "docs/**/*.bak")(job)
+	if err := job.filter.check(); err != nil {
+		t.Fatalf("check filter: %v", err)
+	}
+
+	file, dir := &testFileInfo{size: 1}, &testFileInfo{dir: true}
+	cases := []struct {
+		path string
+		fi   fs.FileInfo
+		keep bool
+	}{
+		{"", dir, true},
+		{"a.txt", file, true},
+		{"a.tmp", file, false},
+		{"sub/b.tmp", file, false},
+		{"sub/keep.tmp", file, true},
+		{"build", dir, false},
+		{"sub/build", dir, true},
+		{"sub/cache", dir, false},
+		{"sub/cache", file, true},
+		{"docs/x.bak", file, false},
+		{"docs/a/b/x.bak", file, false},
+		{"sub/docs/x.bak", file, true},
+	}
+	for _, c := range cases {
+		if keep, _ := job.filter.match(c.path, c.fi, false); keep != c.keep {
+			t.Errorf("match %q dir= %v, keep= %v want= %v", c.path, c.fi.IsDir(), keep, c.keep)
+		}
+	}
+}
+
+func TestFilterIncludeAndPredicates(t *testing.T) {
+	now := time.Now()
+	job := new(wildcardJob)
+	job = Include("*.jpg", "raw/")(job)
+	job = MinSize(10)(job)
+	job = NewerThan(now.Add(-time.Hour))(job)
+	if err := job.filter.check(); err != nil {
+		t.Fatalf("check filter: %v", err)
+	}
+
+	if keep, _ := job.filter.match("a/b.jpg", &testFileInfo{size: 10, mod: now}, false); !keep {
+		t.Errorf("included file is skipped")
+	}
+	if keep, _ := job.filter.match("a/b.png", &testFileInfo{size: 10, mod: now}, false); keep {
+		t.Errorf("not included file is kept")
+	}
+	if keep, _ := job.filter.match("a/b.jpg", &testFileInfo{size: 9, mod: now}, false); keep {
+		t.Errorf("small file is kept")
+	}
+	if keep, _ := job.filter.match("a/b.jpg", &testFileInfo{size: 10, mod: now.Add(-2 * time.Hour)}, false); keep {
+		t.Errorf("old file is kept")
+	}
+
+	keep, included := job.filter.match("a/raw", &testFileInfo{dir: true}, false)
+	if !keep || !included {
+		t.Fatalf("included dir, keep= %v included= %v", keep, included)
+	}
+	if keep, _ := job.filter.match("a/raw/c.cr2", &testFileInfo{size: 10, mod: now}, included); !keep {
+		t.Errorf("file in included dir is skipped")
+	}
+}
+
+func TestFilterInvalidPattern(t *testing.T) {
+	job := Exclude("[z-a]")(new(wildcardJob))
+	if err := job.filter.check(); err == nil {
+		t.Fatalf("invalid pattern is accepted")
+	}
+
+	file := filepath.Join(t.TempDir(), "ignore")
+	writeTestFile(t, file, "*.tmp\n[z-a]\n")
+	job = ExcludeFrom(file)(new(wildcardJob))
+	if err := job.filter.check(); err == nil {
+		t.Fatalf("invalid pattern in file is accepted")
+	}
+}
+
+func TestFilterPath(t *testing.T) {
+	cases := []struct {
+		root, path string
+		dir        bool
+		want       string
+	}{
+		{"src", "src", true, ""},
+		{"a.txt", "a.txt", false, "a.txt"},
+		{"data/a.txt", "data/a.txt", false, "a.txt"},
+		{"src", "src/a/b.txt", false, "a/b.txt"},
+		{"data/src", "data/src/a", true, "a"},
+	}
+	for _, c := range cases {
+		if have := filterPath(c.root, c.path, c.dir); have != c.want {
+			t.Errorf("filter path root= %q path= %q, have= %q want= %q", c.root, c.path, have, c.want)
+		}
+	}
+}
+
+func TestWalkWithFilter(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "src"), filepath.Join(root, "dst")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "aaaa")
+	writeTestFile(t, filepath.Join(src, "b.tmp"), "bbbb")
+	writeTestFile(t, filepath.Join(src, "skip", "c.txt"), "cccc")
+	writeTestFile(t, filepath.Join(src, "top.txt"), "dddd")
+	writeTestFile(t, filepath.Join(src, "sub", "top.txt"), "eeee")
+	writeTestFile(t, filepath.Join(root, "ignore"), "# comment\nskip/\n/top.txt\n")
+	mkdirTest(t, dst)
+
+	var skipped int64
+	report := runCopyer(
+		t,
+		WildcardJob(Source(src), Target(dst), Exclude("*.tmp"), ExcludeFrom(filepath.Join(root, "ignore"))),
+		WithEventHandler(func(ev Event) {
+			if e, ok := ev.(*EventUpdateCount); ok && e.Finished {
+				skipped = e.Skipped
+			}
+		}),
+	)
+	if len(report.Jobs) != 2 || findReportJob(report, "src/a.txt") == nil || findReportJob(report, "src/sub/top.txt") == nil {
+		t.Fatalf("unexpected jobs, %+v", report.Jobs)
+	}
+	if skipped != 3 {
+		t.Fatalf("skipped = %d", skipped)
+	}
+}
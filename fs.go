@@ -3,6 +3,7 @@ package acp
 import (
 	"fmt"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	mapset "github.com/deckarep/golang-set/v2"
@@ -33,6 +34,8 @@ func getMountpointCache() (func(string) string, error) {
 	}
 
 	mps := mountPoints.ToSlice()
+	// nested mount points are matched before their parents
+	sort.Slice(mps, func(i, j int) bool { return len(mps[i]) > len(mps[j]) })
 	return Cache(func(path string) string {
 		path, err := filepath.Abs(path)
 		if err != nil {
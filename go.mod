@@ -14,6 +14,8 @@ require (
 	github.com/samuelncui/godf v0.0.0-20231004032257-e436410ad5a0
 	github.com/schollz/progressbar/v3 v3.13.1
 	github.com/sirupsen/logrus v1.9.3
+	github.com/zeebo/blake3 v0.2.4
+	github.com/zeebo/xxh3 v1.0.2
 	golang.org/x/sys v0.12.0
 )
 
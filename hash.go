@@ -0,0 +1,177 @@
+package acp
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	sha256 "github.com/minio/sha256-simd"
+	"github.com/samber/lo"
+	"github.com/samuelncui/acp/mmap"
+	"github.com/zeebo/blake3"
+	"github.com/zeebo/xxh3"
+)
+
+const (
+	HashSHA256 = "sha256"
+	HashSHA1   = "sha1"
+	HashSHA512 = "sha512"
+	HashMD5    = "md5"
+	HashCRC32C = "crc32c"
+	HashXXH3   = "xxh3"
+	HashBLAKE3 = "blake3"
+)
+
+var (
+	hashLock  sync.RWMutex
+	hashPools = make(map[string]*sync.Pool, 8)
+)
+
+func init() {
+	RegisterHash(HashSHA256, sha256.New)
+	RegisterHash(HashSHA1, sha1.New)
+	RegisterHash(HashSHA512, sha512.New)
+	RegisterHash(HashMD5, md5.New)
+	RegisterHash(HashCRC32C, func() hash.Hash { return crc32.New(crc32.MakeTable(crc32.Castagnoli)) })
+	RegisterHash(HashXXH3, func() hash.Hash { return xxh3.New() })
+	RegisterHash(HashBLAKE3, func() hash.Hash { return blake3.New() })
+}
+
+// RegisterHash add a hash algorithm which can be used by `WithHashes`.
+// Registering an exists name replaces the previous one.
+func RegisterHash(name string, newHash func() hash.Hash) {
+	hashLock.Lock()
+	defer hashLock.Unlock()
+
+	hashPools[name] = &sync.Pool{New: func() interface{} { return newHash() }}
+}
+
+// RegisteredHashes returns names of all registered hash algorithms.
+func RegisteredHashes() []string {
+	hashLock.RLock()
+	defer hashLock.RUnlock()
+
+	names := make([]string, 0, len(hashPools))
+	for name := range hashPools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func checkHash(name string) error {
+	hashLock.RLock()
+	defer hashLock.RUnlock()
+
+	if _, has := hashPools[name]; !has {
+		return fmt.Errorf("hash algorithm not registered, name= %s", name)
+	}
+	return nil
+}
+
+func getHasher(name string) hash.Hash {
+	hashLock.RLock()
+	pool := hashPools[name]
+	hashLock.RUnlock()
+
+	h := pool.Get().(hash.Hash)
+	h.Reset()
+	return h
+}
+
+func putHasher(name string, h hash.Hash) {
+	hashLock.RLock()
+	pool := hashPools[name]
+	hashLock.RUnlock()
+
+	pool.Put(h)
+}
+
+// WithHashes calculate hash of each file with given algorithms while copying, the results
+// can be found in `Job.Hashes`. Use `RegisterHash` to add more algorithms.
+func WithHashes(names ...string) Option {
+	return func(o *option) *option {
+		for _, name := range names {
+			if name == "" || lo.Contains(o.hashes, name) {
+				continue
+			}
+			o.hashes = append(o.hashes, name)
+		}
+		return o
+	}
+}
+
+// hashReader reads all data from reader, and returns the hash results by algorithm name.
+func hashReader(reader io.Reader, names ...string) (map[string][]byte, error) {
+	hashers := make([]hash.Hash, 0, len(names))
+	writers := make([]io.Writer, 0, len(names))
+	for _, name := range names {
+		h := getHasher(name)
+		defer putHasher(name, h)
+
+		hashers = append(hashers, h)
+		writers = append(writers, h)
+	}
+
+	if _, err := io.CopyBuffer(io.MultiWriter(writers...), reader, make([]byte, batchSize)); err != nil {
+		return nil, fmt.Errorf("read for hash fail, %w", err)
+	}
+
+	results := make(map[string][]byte, len(names))
+	for idx, name := range names {
+		results[name] = hashers[idx].Sum(nil)
+	}
+	return results, nil
+}
+
+// HashFile reads file by mmap, and returns the hex encoded hash results by algorithm name.
+func HashFile(path string, names ...string) (map[string]string, error) {
+	for _, name := range names {
+		if err := checkHash(name); err != nil {
+			return nil, err
+		}
+	}
+
+	results, err := hashFile(path, false, names...)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := make(map[string]string, len(results))
+	for name, h := range results {
+		encoded[name] = hex.EncodeToString(h)
+	}
+	return encoded, nil
+}
+
+func hashFile(path string, linear bool, names ...string) (map[string][]byte, error) {
+	if linear {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("open file fail, %w", err)
+		}
+		defer file.Close()
+
+		return hashReader(file, names...)
+	}
+
+	readerAt, err := mmap.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open file by mmap fail, %w", err)
+	}
+	defer readerAt.Close()
+
+	if readerAt.Len() == 0 {
+		return hashReader(bytes.NewReader(nil), names...)
+	}
+	return hashReader(mmap.NewReader(readerAt), names...)
+}
@@ -0,0 +1,64 @@
+package acp
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"path/filepath"
+	"testing"
+
+	sha256 "github.com/minio/sha256-simd"
+	"github.com/zeebo/blake3"
+	"github.com/zeebo/xxh3"
+)
+
+func TestWithHashes(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "src"), filepath.Join(root, "dst")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "aaaa")
+	mkdirTest(t, dst)
+
+	RegisterHash("test-md5", md5.New)
+	report := runCopyer(t, WildcardJob(Source(src), Target(dst)), WithHash(true), WithHashes(HashMD5, "test-md5"))
+
+	job := findReportJob(report, "src/a.txt")
+	if job == nil {
+		t.Fatalf("job not found")
+	}
+
+	wantMD5, wantSHA256 := md5.Sum([]byte("aaaa")), sha256.Sum256([]byte("aaaa"))
+	if job.Hashes[HashMD5] != hex.EncodeToString(wantMD5[:]) || job.Hashes["test-md5"] != job.Hashes[HashMD5] {
+		t.Fatalf("unexpected md5, %v", job.Hashes)
+	}
+	if job.SHA256 != hex.EncodeToString(wantSHA256[:]) || job.Hashes[HashSHA256] != job.SHA256 {
+		t.Fatalf("unexpected sha256, sha256= %s hashes= %v", job.SHA256, job.Hashes)
+	}
+}
+
+func TestBuiltinHashes(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "src"), filepath.Join(root, "dst")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "aaaa")
+	mkdirTest(t, dst)
+
+	report := runCopyer(t, WildcardJob(Source(src), Target(dst)), WithHash(true), WithHashes(HashXXH3, HashBLAKE3))
+	job := findReportJob(report, "src/a.txt")
+	if job == nil {
+		t.Fatalf("job not found")
+	}
+
+	wantXXH3, wantBLAKE3 := xxh3.New(), blake3.Sum256([]byte("aaaa"))
+	wantXXH3.WriteString("aaaa")
+	if job.Hashes[HashXXH3] != hex.EncodeToString(wantXXH3.Sum(nil)) {
+		t.Fatalf("unexpected xxh3, %v", job.Hashes)
+	}
+	if job.Hashes[HashBLAKE3] != hex.EncodeToString(wantBLAKE3[:]) {
+		t.Fatalf("unexpected blake3, %v", job.Hashes)
+	}
+}
+
+func TestWithHashesNotRegistered(t *testing.T) {
+	opt := WithHashes("not-registered")(newOption())
+	if err := opt.check(); err == nil {
+		t.Fatalf("expect error for unregistered hash")
+	}
+}
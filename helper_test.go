@@ -0,0 +1,74 @@
+package acp
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func runCopyer(t *testing.T, opts ...Option) *Report {
+	t.Helper()
+
+	handler, getter := NewReportGetter()
+	opts = append(opts, WithEventHandler(handler))
+
+	c, err := New(context.Background(), opts...)
+	if err != nil {
+		t.Fatalf("new copyer: %v", err)
+	}
+	c.Wait()
+
+	return getter()
+}
+
+func writeTestFile(t *testing.T, name, content string) {
+	t.Helper()
+
+	mkdirTest(t, filepath.Dir(name))
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+}
+
+func mkdirTest(t *testing.T, dirs ...string) {
+	t.Helper()
+
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatalf("mkdir %s: %v", dir, err)
+		}
+	}
+}
+
+func findReportJob(report *Report, relativePath string) *Job {
+	for _, job := range report.Jobs {
+		if job.Path == relativePath {
+			return job
+		}
+	}
+	return nil
+}
+
+// indexedHandler returns a handler, and a chan closed after sources are indexed.
+func indexedHandler() (EventHandler, <-chan struct{}) {
+	indexed := make(chan struct{})
+	var once sync.Once
+	return func(ev Event) {
+		if e, ok := ev.(*EventUpdateCount); ok && e.Finished {
+			once.Do(func() { close(indexed) })
+		}
+	}, indexed
+}
+
+func waitIndexed(t *testing.T, indexed <-chan struct{}) {
+	t.Helper()
+
+	select {
+	case <-indexed:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("sources are not indexed")
+	}
+}
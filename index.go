@@ -5,9 +5,10 @@ import (
 	"fmt"
 	"os"
 	"sort"
-	"strings"
 	"sync/atomic"
 	"time"
+
+	"github.com/sirupsen/logrus"
 )
 
 const (
@@ -16,10 +17,13 @@ const (
 
 type counter struct {
 	bytes, files int64
+	skipped      int64
+	physical     int64
 }
 
 func (c *Copyer) index(ctx context.Context) (<-chan *baseJob, error) {
-	jobs, err := c.walk(ctx)
+	cntr := new(counter)
+	jobs, err := c.walk(ctx, cntr)
 	if err != nil {
 		return nil, err
 	}
@@ -35,98 +39,177 @@ func (c *Copyer) index(ctx context.Context) (<-chan *baseJob, error) {
 			case ch <- job:
 			}
 		}
+
+		// archives can only be read in order, so members are indexed while copying
+		for _, j := range c.wildcardJobs {
+			for _, t := range j.tars {
+				if err := c.indexTar(ctx, j, t, ch, cntr); err != nil {
+					c.reportError(t.name, "", fmt.Errorf("read tar source fail, %w", err))
+				}
+			}
+		}
 	})
 
 	return ch, nil
 }
 
-func (c *Copyer) walk(ctx context.Context) ([]*baseJob, error) {
-	done := make(chan struct{})
-	defer close(done)
+func (c *Copyer) walk(ctx context.Context, cntr *counter) ([]*baseJob, error) {
+	done, exited := make(chan struct{}), make(chan struct{})
+	defer func() {
+		close(done)
+		<-exited
+	}()
 
-	cntr := new(counter)
 	go wrap(ctx, func() {
+		defer close(exited)
+
 		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
 		for {
 			select {
 			case <-ticker.C:
-				c.submit(&EventUpdateCount{Bytes: atomic.LoadInt64(&cntr.bytes), Files: atomic.LoadInt64(&cntr.files)})
+				c.submit(&EventUpdateCount{
+					Bytes:   atomic.LoadInt64(&cntr.bytes),
+					Files:   atomic.LoadInt64(&cntr.files),
+					Skipped: atomic.LoadInt64(&cntr.skipped),
+				})
 			case <-done:
-				c.submit(&EventUpdateCount{Bytes: atomic.LoadInt64(&cntr.bytes), Files: atomic.LoadInt64(&cntr.files), Finished: true})
+				c.submit(&EventUpdateCount{
+					Bytes:    atomic.LoadInt64(&cntr.bytes),
+					Files:    atomic.LoadInt64(&cntr.files),
+					Skipped:  atomic.LoadInt64(&cntr.skipped),
+					Finished: true,
+				})
 				return
 			}
 		}
 	})
 
 	jobs := make([]*baseJob, 0, 64)
+	// jobs skipped or finished by previous run, their targets can be hard linked to
+	var linkSources []*baseJob
 	appendJob := func(job *baseJob) {
-		if !job.stat.mode.IsRegular() {
-			c.reportError(
-				job.path, "",
-				fmt.Errorf(
-					"unexpected file mode, not regular file, mode= %s",
-					job.stat.mode,
-				),
-			)
+		if c.admitJob(job, cntr) {
+			jobs = append(jobs, job)
 			return
 		}
+		if c.hardLinks && job.isFinished() && job.stat.mode.IsRegular() {
+			linkSources = append(linkSources, job)
+		}
+	}
+	// span volumes of the current wildcard job
+	var span *spanVolumes
+	appendWalked := func(src *source, path string, fi os.FileInfo, dsts []string) {
+		targets := make([]string, 0, len(dsts))
+		for _, d := range dsts {
+			targets = append(targets, src.dst(d))
+		}
+		c.cleanupTargetDirs(append(span.targets(src), targets...), fi.IsDir())
 
-		c.submit(&EventUpdateJob{job.report()})
-		jobs = append(jobs, job)
-		atomic.AddInt64(&cntr.files, 1)
-		atomic.AddInt64(&cntr.bytes, job.stat.size)
+		stat, err := newStat(path, fi)
+		if err != nil {
+			c.reportError(path, "", fmt.Errorf("read sys stat, %w", err))
+			return
+		}
+
+		appendJob(&baseJob{
+			copyer:  c,
+			src:     src,
+			path:    path,
+			stat:    stat,
+			targets: targets,
+			span:    span,
+		})
 	}
 
-	var walk func(src *source, dsts []string)
-	walk = func(src *source, dsts []string) {
+	appendDir := func(src *source, path string, fi os.FileInfo, dsts []string) {
+		if len(dsts) == 0 && c.archive == nil && span == nil {
+			return
+		}
+
+		stat, err := newStat(path, fi)
+		if err != nil {
+			c.reportError(path, "", fmt.Errorf("read dir sys stat, %w", err))
+			return
+		}
+
+		targets := make([]string, 0, len(dsts))
+		for _, d := range dsts {
+			targets = append(targets, src.dst(d))
+		}
+		targets = append(targets, span.targets(src)...)
+		c.cleanupTargetDirs(targets, true)
+		c.dirs = append(c.dirs, &dirJob{src: src, path: path, stat: stat, targets: targets})
+	}
+
+	// entries walked from the current wildcard job, for deleting extraneous targets
+	var walked []walkedEntry
+	var walkErrs int
+
+	// path of the walked source root, filters match paths relative to it
+	var root string
+
+	var walk func(src *source, dsts []string, filter *fileFilter, included bool)
+	walk = func(src *source, dsts []string, filter *fileFilter, included bool) {
 		path := src.src()
 
-		fi, err := os.Stat(path)
+		fi, err := c.walkStat(path)
 		if err != nil {
+			walkErrs++
 			c.reportError(path, "", fmt.Errorf("walk get stat, %w", err))
 			return
 		}
 
-		mode := fi.Mode()
-		if mode.IsRegular() {
-			targets := make([]string, 0, len(dsts))
-			for _, d := range dsts {
-				targets = append(targets, src.dst(d))
-			}
+		keep, included := filter.match(filterPath(root, src.path, fi.IsDir()), fi, included)
+		if !keep {
+			atomic.AddInt64(&cntr.skipped, 1)
+			c.logf(logrus.DebugLevel, "walk skip filtered path, %s", path)
+			return
+		}
+		if c.withDelete {
+			walked = append(walked, walkedEntry{path: src.path, dir: fi.IsDir()})
+		}
 
-			stat, err := newStat(path, fi)
-			if err != nil {
-				c.reportError(path, "", fmt.Errorf("read sys stat, %w", err))
+		mode := fi.Mode()
+		if !mode.IsDir() {
+			if !c.acceptMode(mode) {
 				return
 			}
 
-			appendJob(&baseJob{
-				copyer:  c,
-				src:     src,
-				path:    path,
-				stat:    stat,
-				targets: targets,
-			})
-			return
-		}
-		if mode&UnexpectFileMode != 0 {
+			appendWalked(src, path, fi, dsts)
 			return
 		}
 
 		files, err := os.ReadDir(path)
 		if err != nil {
+			walkErrs++
 			c.reportError(path, "", fmt.Errorf("walk read dir, %w", err))
 			return
 		}
+		if len(files) == 0 && c.emptyDirs {
+			appendWalked(src, path, fi, dsts)
+			return
+		}
+
+		appendDir(src, path, fi, dsts)
 		for _, file := range files {
-			walk(src.append(file.Name()), dsts)
+			walk(src.append(file.Name()), dsts, filter, included)
 		}
 	}
 
 	results := make([]*baseJob, 0, 64)
 	for _, j := range c.wildcardJobs {
+		walked, walkErrs, span, linkSources = walked[:0], 0, j.span, linkSources[:0]
 		for _, s := range j.src {
-			walk(s, j.dst)
+			root = s.path
+			walk(s, j.dst, j.filter, false)
+		}
+		if c.withDelete {
+			if walkErrs == 0 {
+				c.deleteExtraneous(ctx, j, walked)
+			} else {
+				c.logf(logrus.WarnLevel, "walk source have errors, skip deleting extraneous targets, errors= %d", walkErrs)
+			}
 		}
 
 		if len(jobs) == 0 {
@@ -137,6 +220,12 @@ func (c *Copyer) walk(ctx context.Context) ([]*baseJob, error) {
 		if err != nil {
 			return nil, err
 		}
+		if c.hardLinks {
+			for _, job := range c.linkJobs(joined, linkSources) {
+				atomic.AddInt64(&cntr.bytes, -job.stat.size)
+			}
+		}
+		c.orderJobs(joined, j.order)
 
 		results = append(results, joined...)
 		jobs = jobs[:0]
@@ -171,10 +260,56 @@ func (c *Copyer) walk(ctx context.Context) ([]*baseJob, error) {
 	return results, nil
 }
 
+// admitJob checks the job and submits it, returns false if the job need not to be copied,
+// such like finished by previous run or skipped by update policy.
+func (c *Copyer) admitJob(job *baseJob, cntr *counter) bool {
+	if !c.acceptMode(job.stat.mode) {
+		c.reportError(
+			job.path, "",
+			fmt.Errorf(
+				"unexpected file mode, not regular file, mode= %s",
+				job.stat.mode,
+			),
+		)
+		return false
+	}
+
+	c.resume(job)
+	if len(job.targets) == 0 && len(job.successTargets) > 0 {
+		job.status = jobStatusFinished
+		if c.dryRun {
+			c.planJob(job)
+		}
+		c.submit(&EventUpdateJob{job.report()})
+		return false
+	}
+
+	c.checkUpdate(job)
+	if len(job.targets) == 0 && len(job.skipTargets) > 0 {
+		if len(job.successTargets) > 0 {
+			job.status = jobStatusFinished
+		} else {
+			job.status = jobStatusSkipped
+		}
+		if c.dryRun {
+			c.planJob(job)
+		}
+		c.submit(&EventUpdateJob{job.report()})
+		atomic.AddInt64(&cntr.skipped, 1)
+		return false
+	}
+
+	c.submit(&EventUpdateJob{job.report()})
+	atomic.AddInt64(&cntr.files, 1)
+	if job.stat.mode.IsRegular() {
+		atomic.AddInt64(&cntr.bytes, job.stat.size)
+	}
+	return true
+}
+
 func (c *Copyer) joinJobs(jobs []*baseJob) ([]*baseJob, error) {
 	sort.Slice(jobs, func(i int, j int) bool {
-		si, sj := strings.ReplaceAll(jobs[i].src.path, "/", "\x00"), strings.ReplaceAll(jobs[j].src.path, "/", "\x00")
-		return si < sj
+		return pathKey(jobs[i].src.path) < pathKey(jobs[j].src.path)
 	})
 
 	var last *baseJob
@@ -191,3 +326,67 @@ func (c *Copyer) joinJobs(jobs []*baseJob) ([]*baseJob, error) {
 
 	return filtered, nil
 }
+
+type fileID struct {
+	dev, ino uint64
+}
+
+// linkJobs finds jobs of the same file by inode, the first one in order is copied, and others are
+// linked to it. Jobs in sources are not copied, but preferred as primaries, since their targets
+// are already finished. Returns the linked jobs.
+func (c *Copyer) linkJobs(jobs []*baseJob, sources []*baseJob) []*baseJob {
+	primaries := make(map[fileID]*baseJob, 8)
+	linked := make([]*baseJob, 0, 8)
+	for _, job := range sources {
+		id, ok := getFileID(job.stat)
+		if !ok {
+			continue
+		}
+		if _, has := primaries[id]; !has {
+			primaries[id] = job
+		}
+	}
+	for _, job := range jobs {
+		id, ok := getFileID(job.stat)
+		if !ok {
+			continue
+		}
+
+		primary, has := primaries[id]
+		if !has {
+			primaries[id] = job
+			continue
+		}
+
+		job.linkTo = primary
+		c.submit(&EventUpdateJob{job.report()})
+		linked = append(linked, job)
+	}
+	return linked
+}
+
+// walkStat returns the stat of path, symbolic links are only dereferenced when links are not preserved.
+func (c *Copyer) walkStat(path string) (os.FileInfo, error) {
+	if c.preserveLinks {
+		return os.Lstat(path)
+	}
+	return os.Stat(path)
+}
+
+// acceptMode reports whether a file with the mode can be copied by this copyer.
+func (c *Copyer) acceptMode(mode os.FileMode) bool {
+	switch {
+	case mode.IsRegular():
+		return true
+	case mode.IsDir():
+		return c.emptyDirs
+	case mode&os.ModeSymlink != 0:
+		return c.preserveLinks
+	case mode&os.ModeSocket != 0:
+		return false
+	case mode&(os.ModeNamedPipe|os.ModeDevice) != 0:
+		return c.specialFiles
+	default:
+		return false
+	}
+}
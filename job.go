@@ -16,13 +16,19 @@ const (
 	jobStatusPreparing
 	jobStatusCopying
 	jobStatusFinishing
+	jobStatusVerifying
 	jobStatusFinished
+	jobStatusSkipped
+	jobStatusPlanned
 
 	JobStatusPending   = "pending"
 	JobStatusPreparing = "preparing"
 	JobStatusCopying   = "copying"
 	JobStatusFinishing = "finishing"
+	JobStatusVerifying = "verifying"
 	JobStatusFinished  = "finished"
+	JobStatusSkipped   = "skipped"
+	JobStatusPlanned   = "planned"
 )
 
 var (
@@ -31,7 +37,10 @@ var (
 		jobStatusPreparing: JobStatusPreparing,
 		jobStatusCopying:   JobStatusCopying,
 		jobStatusFinishing: JobStatusFinishing,
+		jobStatusVerifying: JobStatusVerifying,
 		jobStatusFinished:  JobStatusFinished,
+		jobStatusSkipped:   JobStatusSkipped,
+		jobStatusPlanned:   JobStatusPlanned,
 	}
 )
 
@@ -48,7 +57,27 @@ type baseJob struct {
 	targets        []string
 	successTargets []string
 	failedTargets  map[string]error
-	hash           []byte
+	skipTargets    []string
+	planTargets    map[string]string
+	archive        *ArchiveMember
+	hashes         map[string][]byte
+
+	// linkTo is the job of another path of the same file, which is copied instead of this one,
+	// targets of this job will be hard linked to targets of it.
+	linkTo *baseJob
+
+	// stream is the data of a tar member, which can only be read once
+	stream *tarStream
+
+	// tmpTargets maps targets to their temp files, when atomic write is enabled
+	tmpTargets map[string]string
+
+	// attempts is tries of the job, retries after transient errors are included
+	attempts int
+
+	// span is the volumes of span target, volume is the one chosen when writing
+	span   *spanVolumes
+	volume string
 }
 
 func (j *baseJob) setStatus(s jobStatus) {
@@ -63,11 +92,27 @@ func (j *baseJob) setStatus(s jobStatus) {
 	j.copyer.submit(&EventUpdateJob{j.report()})
 }
 
-func (j *baseJob) setHash(h []byte) {
+// isFinished reports whether the job is finished, skipped jobs are finished by previous copy.
+func (j *baseJob) isFinished() bool {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.status == jobStatusFinished || j.status == jobStatusSkipped
+}
+
+// hasData reports whether the data of source need to be read and written to targets.
+func (j *baseJob) hasData() bool {
+	return j.linkTo == nil && j.stat.mode.IsRegular()
+}
+
+func (j *baseJob) setHash(name string, h []byte) {
 	j.lock.Lock()
 	defer j.lock.Unlock()
 
-	j.hash = h
+	if j.hashes == nil {
+		j.hashes = make(map[string][]byte, 1)
+	}
+
+	j.hashes[name] = h
 	j.copyer.submit(&EventUpdateJob{j.report()})
 }
 
@@ -91,7 +136,94 @@ func (j *baseJob) fail(path string, err error) {
 	j.copyer.submit(&EventUpdateJob{j.report()})
 }
 
+func (j *baseJob) addAttempt() {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.attempts++
+}
+
+func (j *baseJob) getAttempts() int {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.attempts
+}
+
+func (j *baseJob) getFailed(target string) error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.failedTargets[target]
+}
+
+// clearFailed removes targets from failed targets, before they are retried.
+func (j *baseJob) clearFailed(targets []string) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	for _, target := range targets {
+		delete(j.failedTargets, target)
+	}
+	if len(j.failedTargets) == 0 {
+		j.failedTargets = nil
+	}
+}
+
+func (j *baseJob) setTmpTarget(target, tmp string) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	if j.tmpTargets == nil {
+		j.tmpTargets = make(map[string]string, len(j.targets))
+	}
+	j.tmpTargets[target] = tmp
+}
+
+// writePath returns the path which data of target is written to, before it is renamed into place.
+func (j *baseJob) writePath(target string) string {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	if tmp, has := j.tmpTargets[target]; has {
+		return tmp
+	}
+	return target
+}
+
+// revoke moves a success target into failed targets, used when a target is broken after write.
+func (j *baseJob) revoke(path string, err error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	successTargets := make([]string, 0, len(j.successTargets))
+	for _, target := range j.successTargets {
+		if target == path {
+			continue
+		}
+		successTargets = append(successTargets, target)
+	}
+	j.successTargets = successTargets
+
+	if j.failedTargets == nil {
+		j.failedTargets = make(map[string]error, 1)
+	}
+
+	j.failedTargets[path] = err
+	j.copyer.submit(&EventUpdateJob{j.report()})
+}
+
 func (j *baseJob) report() *Job {
+	var hashes map[string]string
+	if len(j.hashes) > 0 {
+		hashes = make(map[string]string, len(j.hashes))
+		for name, h := range j.hashes {
+			hashes[name] = hex.EncodeToString(h)
+		}
+	}
+
+	var hardLinkTo string
+	if j.linkTo != nil {
+		hardLinkTo = j.linkTo.path
+	}
+
 	return &Job{
 		FullPath: path.Join(j.src.base, j.src.path),
 		Base:     j.src.base,
@@ -100,20 +232,41 @@ func (j *baseJob) report() *Job {
 		Status:         statusMapping[j.status],
 		SuccessTargets: j.successTargets,
 		FailTargets:    j.failedTargets,
+		SkipTargets:    j.skipTargets,
+		PlanTargets:    j.planTargets,
+		Archive:        j.archive,
+		Attempts:       j.attempts,
+		Volume:         j.volume,
 
 		Size:      j.stat.size,
 		Mode:      j.stat.mode,
 		ModTime:   j.stat.modTime,
 		WriteTime: j.writeTime,
-		SHA256:    hex.EncodeToString(j.hash),
+		SHA256:    hex.EncodeToString(j.hashes[HashSHA256]),
+		Hashes:    hashes,
+
+		LinkTarget: j.stat.link,
+		HardLinkTo: hardLinkTo,
 	}
 }
 
 type writeJob struct {
 	*baseJob
-	reader io.ReadCloser
-	size   int64
-	ch     chan struct{}
+	reader  io.ReadCloser
+	size    int64
+	extents []extent
+	ch      chan struct{}
+
+	// retryTargets are targets written again after transient errors, nil for the first try
+	retryTargets []string
+}
+
+// writeTargets returns targets should be written in this try.
+func (wj *writeJob) writeTargets() []string {
+	if wj.retryTargets != nil {
+		return wj.retryTargets
+	}
+	return wj.targets
 }
 
 func newWriteJob(job *baseJob, src io.ReadCloser, size int64, needWait bool) *writeJob {
@@ -129,7 +282,9 @@ func newWriteJob(job *baseJob, src io.ReadCloser, size int64, needWait bool) *wr
 }
 
 func (wj *writeJob) done() {
-	wj.reader.Close()
+	if wj.reader != nil {
+		wj.reader.Close()
+	}
 
 	if wj.ch != nil {
 		close(wj.ch)
@@ -148,13 +303,26 @@ type Job struct {
 	Base     string `json:"base"`
 	Path     string `json:"path"`
 
-	Status         string           `json:"status"`
-	SuccessTargets []string         `json:"success_target,omitempty"`
-	FailTargets    map[string]error `json:"fail_target,omitempty"`
+	Status         string            `json:"status"`
+	SuccessTargets []string          `json:"success_target,omitempty"`
+	FailTargets    map[string]error  `json:"fail_target,omitempty"`
+	SkipTargets    []string          `json:"skip_target,omitempty"`
+	PlanTargets    map[string]string `json:"plan_target,omitempty"`
+
+	Size      int64             `json:"size"`
+	Mode      fs.FileMode       `json:"mode"`
+	ModTime   time.Time         `json:"mod_time"`
+	WriteTime time.Time         `json:"write_time"`
+	SHA256    string            `json:"sha256"`
+	Hashes    map[string]string `json:"hashes,omitempty"`
+
+	LinkTarget string `json:"link_target,omitempty"`
+	HardLinkTo string `json:"hard_link_to,omitempty"`
+
+	Archive *ArchiveMember `json:"archive,omitempty"`
 
-	Size      int64       `json:"size"`
-	Mode      fs.FileMode `json:"mode"`
-	ModTime   time.Time   `json:"mod_time"`
-	WriteTime time.Time   `json:"write_time"`
-	SHA256    string      `json:"sha256"`
+	// Attempts is tries of the job, more than 1 if it is retried after transient errors
+	Attempts int `json:"attempts,omitempty"`
+	// Volume is the span target volume which the file is written into
+	Volume string `json:"volume,omitempty"`
 }
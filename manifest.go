@@ -0,0 +1,215 @@
+package acp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+type ManifestFormat string
+
+const (
+	// ManifestGNU is the format of `sha256sum`, line like `<hash>  <path>`.
+	ManifestGNU = ManifestFormat("gnu")
+	// ManifestBSD is the format of `sha256sum --tag`, line like `SHA256 (<path>) = <hash>`.
+	ManifestBSD = ManifestFormat("bsd")
+)
+
+var manifestFormatNames = map[string]ManifestFormat{
+	"gnu": ManifestGNU,
+	"bsd": ManifestBSD,
+}
+
+// ParseManifestFormat parses manifest format from name, can be 'gnu' or 'bsd'.
+func ParseManifestFormat(name string) (ManifestFormat, error) {
+	format, has := manifestFormatNames[name]
+	if !has {
+		return "", fmt.Errorf("unexpected manifest format, '%s'", name)
+	}
+	return format, nil
+}
+
+type ManifestEntry struct {
+	Algorithm string `json:"algorithm"`
+	Hash      string `json:"hash"`
+	Path      string `json:"path"`
+}
+
+// ManifestFileName returns the conventional manifest file name of an algorithm, such like `SHA256SUMS`.
+func ManifestFileName(algorithm string) string {
+	return strings.ToUpper(algorithm) + "SUMS"
+}
+
+// WriteManifest writes entries to w in the given format.
+func WriteManifest(w io.Writer, format ManifestFormat, entries []*ManifestEntry) error {
+	bw := bufio.NewWriter(w)
+	for _, e := range entries {
+		name, escaped := escapeManifestPath(e.Path)
+		prefix := ""
+		if escaped {
+			prefix = "\\"
+		}
+
+		var err error
+		switch format {
+		case ManifestBSD:
+			_, err = fmt.Fprintf(bw, "%s%s (%s) = %s\n", prefix, strings.ToUpper(e.Algorithm), name, e.Hash)
+		case ManifestGNU, "":
+			_, err = fmt.Fprintf(bw, "%s%s  %s\n", prefix, e.Hash, name)
+		default:
+			return fmt.Errorf("unexpected manifest format, %s", format)
+		}
+		if err != nil {
+			return fmt.Errorf("write manifest fail, %w", err)
+		}
+	}
+	return bw.Flush()
+}
+
+// ReadManifest parses a manifest in GNU or BSD format, the format is detected line by line.
+// `algorithm` is used for GNU format lines, which do not carry the algorithm name.
+func ReadManifest(r io.Reader, algorithm string) ([]*ManifestEntry, error) {
+	entries := make([]*ManifestEntry, 0, 64)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		escaped := strings.HasPrefix(line, "\\")
+		if escaped {
+			line = line[1:]
+		}
+
+		e, err := parseManifestLine(line, algorithm)
+		if err != nil {
+			return nil, fmt.Errorf("parse manifest fail, line= %d, %w", lineNo, err)
+		}
+		if escaped {
+			e.Path = unescapeManifestPath(e.Path)
+		}
+
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read manifest fail, %w", err)
+	}
+
+	return entries, nil
+}
+
+func parseManifestLine(line, algorithm string) (*ManifestEntry, error) {
+	// BSD tag format: `SHA256 (path) = hash`
+	if idx := strings.Index(line, " ("); idx > 0 && !strings.ContainsAny(line[:idx], " \t") {
+		if end := strings.LastIndex(line, ") = "); end > idx {
+			return &ManifestEntry{
+				Algorithm: strings.ToLower(line[:idx]),
+				Path:      line[idx+2 : end],
+				Hash:      strings.ToLower(line[end+4:]),
+			}, nil
+		}
+	}
+
+	// GNU format: `hash  path` or `hash *path`
+	idx := strings.IndexByte(line, ' ')
+	if idx <= 0 || len(line) < idx+2 {
+		return nil, fmt.Errorf("unexpected manifest line, %q", line)
+	}
+	if line[idx+1] != ' ' && line[idx+1] != '*' {
+		return nil, fmt.Errorf("unexpected manifest line, %q", line)
+	}
+
+	return &ManifestEntry{
+		Algorithm: algorithm,
+		Hash:      strings.ToLower(line[:idx]),
+		Path:      line[idx+2:],
+	}, nil
+}
+
+func escapeManifestPath(p string) (string, bool) {
+	if !strings.ContainsAny(p, "\\\n\r") {
+		return p, false
+	}
+
+	replacer := strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\r", "\\r")
+	return replacer.Replace(p), true
+}
+
+func unescapeManifestPath(p string) string {
+	replacer := strings.NewReplacer("\\\\", "\\", "\\n", "\n", "\\r", "\r")
+	return replacer.Replace(p)
+}
+
+// ManifestEntries collects the hashes of success targets in report, grouped by target root.
+// Targets which are not placed at `<root>/<Job.Path>`, such like accurate jobs, are ignored.
+func (r *Report) ManifestEntries(algorithm string) map[string][]*ManifestEntry {
+	results := make(map[string][]*ManifestEntry, 4)
+	for _, job := range r.Jobs {
+		hash := job.Hashes[algorithm]
+		if hash == "" && algorithm == HashSHA256 {
+			hash = job.SHA256
+		}
+		if hash == "" {
+			continue
+		}
+
+		for _, target := range job.SuccessTargets {
+			if !strings.HasSuffix(target, "/"+job.Path) {
+				continue
+			}
+
+			root := path.Clean(strings.TrimSuffix(target, job.Path))
+			results[root] = append(results[root], &ManifestEntry{Algorithm: algorithm, Hash: hash, Path: job.Path})
+		}
+	}
+
+	for _, entries := range results {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	}
+	return results
+}
+
+// WriteManifests writes a manifest file named by `ManifestFileName` into each target root of the report,
+// returns paths of written manifests. Exist manifests are not overwritten, it returns an error instead.
+func (r *Report) WriteManifests(algorithm string, format ManifestFormat) ([]string, error) {
+	groups := r.ManifestEntries(algorithm)
+
+	roots := make([]string, 0, len(groups))
+	for root := range groups {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+
+	written := make([]string, 0, len(roots))
+	for _, root := range roots {
+		p := path.Join(root, ManifestFileName(algorithm))
+		if err := writeManifestFile(p, format, groups[root]); err != nil {
+			return written, err
+		}
+		written = append(written, p)
+	}
+	return written, nil
+}
+
+func writeManifestFile(p string, format ManifestFormat, entries []*ManifestEntry) error {
+	file, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return fmt.Errorf("create manifest fail, path= %q, %w", p, err)
+	}
+	defer file.Close()
+
+	if err := WriteManifest(file, format, entries); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("sync manifest fail, path= %q, %w", p, err)
+	}
+	return nil
+}
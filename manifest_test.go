@@ -0,0 +1,90 @@
+package acp
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestManifestRoundTrip(t *testing.T) {
+	entries := []*ManifestEntry{
+		{Algorithm: HashSHA256, Hash: "aa", Path: "dir/a.txt"},
+		{Algorithm: HashSHA256, Hash: "bb", Path: "dir/b (1).txt"},
+		{Algorithm: HashSHA256, Hash: "cc", Path: "dir/new\nline\\.txt"},
+	}
+
+	for _, format := range []ManifestFormat{ManifestGNU, ManifestBSD} {
+		buf := new(bytes.Buffer)
+		if err := WriteManifest(buf, format, entries); err != nil {
+			t.Fatalf("write manifest %s: %v", format, err)
+		}
+
+		parsed, err := ReadManifest(buf, HashSHA256)
+		if err != nil {
+			t.Fatalf("read manifest %s: %v", format, err)
+		}
+		if len(parsed) != len(entries) {
+			t.Fatalf("format %s, parsed entries = %d", format, len(parsed))
+		}
+		for idx, e := range parsed {
+			if *e != *entries[idx] {
+				t.Fatalf("format %s, entry %d = %+v, want %+v", format, idx, e, entries[idx])
+			}
+		}
+	}
+}
+
+func TestReadManifestGNUBinary(t *testing.T) {
+	parsed, err := ReadManifest(bytes.NewBufferString("AABB *bin/a\n\nccdd  b c\n"), HashMD5)
+	if err != nil {
+		t.Fatalf("read manifest: %v", err)
+	}
+	if len(parsed) != 2 || parsed[0].Path != "bin/a" || parsed[0].Hash != "aabb" || parsed[1].Path != "b c" || parsed[1].Algorithm != HashMD5 {
+		t.Fatalf("unexpected entries, %+v %+v", parsed[0], parsed[1])
+	}
+}
+
+func TestReportManifestEntries(t *testing.T) {
+	report := &Report{Jobs: []*Job{
+		{Path: "src/b.txt", SHA256: "bb", SuccessTargets: []string{"/dst1/src/b.txt", "/dst2/src/b.txt"}},
+		{Path: "src/a.txt", SHA256: "aa", SuccessTargets: []string{"/dst1/src/a.txt"}},
+		{Path: "/abs/c.txt", SHA256: "cc", SuccessTargets: []string{"/other/name.txt"}},
+	}}
+
+	groups := report.ManifestEntries(HashSHA256)
+	if len(groups) != 2 {
+		t.Fatalf("unexpected groups, %v", groups)
+	}
+	if dst1 := groups["/dst1"]; len(dst1) != 2 || dst1[0].Path != "src/a.txt" || dst1[1].Path != "src/b.txt" {
+		t.Fatalf("unexpected dst1 entries, %v", dst1)
+	}
+	if dst2 := groups["/dst2"]; len(dst2) != 1 || dst2[0].Hash != "bb" {
+		t.Fatalf("unexpected dst2 entries, %v", dst2)
+	}
+}
+
+func TestParseManifestFormat(t *testing.T) {
+	for name, want := range map[string]ManifestFormat{"gnu": ManifestGNU, "bsd": ManifestBSD} {
+		if got, err := ParseManifestFormat(name); err != nil || got != want {
+			t.Fatalf("parse %s, got= %s, %v", name, got, err)
+		}
+	}
+	if _, err := ParseManifestFormat("sha256sum"); err == nil {
+		t.Fatalf("unexpected format is accepted")
+	}
+}
+
+func TestWriteManifestsNotOverwrite(t *testing.T) {
+	dst := t.TempDir()
+	exists := filepath.Join(dst, ManifestFileName(HashSHA256))
+	writeTestFile(t, exists, "old")
+
+	report := &Report{Jobs: []*Job{{Path: "src/a.txt", SHA256: "aa", SuccessTargets: []string{filepath.Join(dst, "src", "a.txt")}}}}
+	if _, err := report.WriteManifests(HashSHA256, ManifestGNU); err == nil {
+		t.Fatalf("exist manifest is overwritten")
+	}
+	if got, err := os.ReadFile(exists); err != nil || string(got) != "old" {
+		t.Fatalf("exist manifest is changed: %q, %v", got, err)
+	}
+}
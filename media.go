@@ -0,0 +1,189 @@
+package acp
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	mapset "github.com/deckarep/golang-set/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// MediaChangeHandler is called when a target device is full or disappears, such like a removable disk.
+// It should return nil after a new media is mounted at the same mount point, then targets on the device
+// are written again. Returning an error gives up the device, its targets are failed as without handler.
+// Handlers are called one at a time, and should return when ctx is done.
+type MediaChangeHandler func(ctx context.Context, e *EventNeedMedia) error
+
+// WithMediaChange pauses copying and calls handler when a target device needs new media.
+// Sources of tar stream and linear device are not read again, so their targets are not rewritten.
+func WithMediaChange(handler MediaChangeHandler) Option {
+	return func(o *option) *option {
+		o.mediaHandler = handler
+		return o
+	}
+}
+
+type mediaChange struct {
+	lock sync.Mutex
+	seq  int
+	// seq of the last change of each device
+	changed map[string]int
+	// devices waiting for new media
+	waiting map[string]*mediaWait
+	// devices given up by handler
+	declined map[string]error
+	// handler is called one at a time
+	prompt sync.Mutex
+}
+
+type mediaWait struct {
+	done chan struct{}
+	err  error
+}
+
+// mediaSeq returns the seq of media changes, changes after it are treated as new media by needMedia.
+func (c *Copyer) mediaSeq() int {
+	c.media.lock.Lock()
+	defer c.media.lock.Unlock()
+	return c.media.seq
+}
+
+// needMedia waits for new media of device, returns nil if the media is changed. Devices changed after
+// since return at once, so jobs written before the change do not ask for media again.
+func (c *Copyer) needMedia(ctx context.Context, dev, target string, cause error, since int, noSpaceDevices mapset.Set[string]) error {
+	if c.mediaHandler == nil {
+		return cause
+	}
+
+	c.media.lock.Lock()
+	if c.media.changed[dev] > since {
+		c.media.lock.Unlock()
+		return nil
+	}
+	if err, has := c.media.declined[dev]; has {
+		c.media.lock.Unlock()
+		return err
+	}
+	if w, has := c.media.waiting[dev]; has {
+		c.media.lock.Unlock()
+		select {
+		case <-w.done:
+			return w.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if c.media.waiting == nil {
+		c.media.waiting = make(map[string]*mediaWait)
+		c.media.changed = make(map[string]int)
+		c.media.declined = make(map[string]error)
+	}
+	w := &mediaWait{done: make(chan struct{})}
+	c.media.waiting[dev] = w
+	c.media.lock.Unlock()
+
+	w.err = c.changeMedia(ctx, dev, target, cause, noSpaceDevices)
+
+	c.media.lock.Lock()
+	delete(c.media.waiting, dev)
+	if w.err == nil {
+		c.media.seq++
+		c.media.changed[dev] = c.media.seq
+	} else if ctx.Err() == nil {
+		c.media.declined[dev] = w.err
+	}
+	c.media.lock.Unlock()
+
+	close(w.done)
+	return w.err
+}
+
+// changeMedia pauses copying, and calls handler to mount a new media.
+func (c *Copyer) changeMedia(ctx context.Context, dev, target string, cause error, noSpaceDevices mapset.Set[string]) error {
+	c.media.prompt.Lock()
+	defer c.media.prompt.Unlock()
+
+	// pause of user during the prompt is kept after media changed
+	c.pauseMedia()
+	defer c.resumeMedia()
+
+	e := &EventNeedMedia{Device: dev, Target: target, Error: cause}
+	c.logf(logrus.WarnLevel, "target device needs new media, device= '%s', target= '%s', %s", dev, target, cause)
+	c.submitControl(e)
+
+	if err := c.mediaHandler(ctx, e); err != nil {
+		return fmt.Errorf("change media fail, device= '%s', %w", dev, err)
+	}
+	if err := c.reloadMountPoints(); err != nil {
+		return err
+	}
+
+	noSpaceDevices.Remove(dev)
+	if _, err := c.getDiskUsageCache(dev).available(); err != nil {
+		return err
+	}
+
+	c.logf(logrus.InfoLevel, "target device media changed, device= '%s'", dev)
+	return nil
+}
+
+// mediaTargets waits for new media of devices which failed targets of job, returns targets which
+// can be written again.
+func (c *Copyer) mediaTargets(ctx context.Context, job *writeJob, since int, noSpaceDevices mapset.Set[string]) []string {
+	if c.mediaHandler == nil || !c.rewritable(job) {
+		return nil
+	}
+
+	job.lock.Lock()
+	failed := make(map[string]error, len(job.failedTargets))
+	for target, err := range job.failedTargets {
+		if checkErrorAbort(err) {
+			failed[target] = err
+		}
+	}
+	job.lock.Unlock()
+
+	targets := make([]string, 0, len(failed))
+	for target := range failed {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	changed := make(map[string]bool, len(targets))
+	rewrite := make([]string, 0, len(targets))
+	for _, target := range targets {
+		dev := c.getDevice(target)
+		ok, has := changed[dev]
+		if !has {
+			ok = c.needMedia(ctx, dev, target, failed[target], since, noSpaceDevices) == nil
+			changed[dev] = ok
+		}
+		if ok {
+			rewrite = append(rewrite, target)
+		}
+	}
+	return rewrite
+}
+
+// reloadMountPoints gets mount points again, the old media may be unmounted before the new one is mounted.
+func (c *Copyer) reloadMountPoints() error {
+	getDevice, err := getMountpointCache()
+	if err != nil {
+		return err
+	}
+
+	c.mountLock.Lock()
+	defer c.mountLock.Unlock()
+	c.mountPoints = getDevice
+	return nil
+}
+
+// getDevice returns the mount point of path.
+func (c *Copyer) getDevice(path string) string {
+	c.mountLock.RLock()
+	defer c.mountLock.RUnlock()
+	return c.mountPoints(path)
+}
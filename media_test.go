@@ -0,0 +1,176 @@
+package acp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// prepareFullTargets links targets to /dev/full, writing them fails with ENOSPC like a full disk.
+func prepareFullTargets(t *testing.T, dir string, names []string) {
+	t.Helper()
+
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skipf("/dev/full not found, %v", err)
+	}
+	mkdirTest(t, dir)
+	for _, name := range names {
+		if err := os.Symlink("/dev/full", filepath.Join(dir, name)); err != nil {
+			t.Fatalf("symlink %s: %v", name, err)
+		}
+	}
+}
+
+func TestMediaChange(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "src"), filepath.Join(root, "dst")
+
+	files := make(map[string][]byte)
+	names := make([]string, 0, 4)
+	for idx := 0; idx < 4; idx++ {
+		name := fmt.Sprintf("%d.bin", idx)
+		files[name] = bytes.Repeat([]byte{byte('a' + idx)}, batchSize+idx)
+		writeTestFile(t, filepath.Join(src, name), string(files[name]))
+		names = append(names, name)
+	}
+	prepareFullTargets(t, filepath.Join(dst, "src"), names)
+
+	getDevice, err := getMountpointCache()
+	if err != nil {
+		t.Fatalf("get mount points: %v", err)
+	}
+
+	var lock sync.Mutex
+	var prompts, events int
+	handler := func(ctx context.Context, e *EventNeedMedia) error {
+		lock.Lock()
+		defer lock.Unlock()
+
+		prompts++
+		if !errors.Is(e.Error, ErrTargetNoSpace) || e.Device != getDevice(dst) {
+			t.Errorf("unexpected need media event: %+v", e)
+		}
+		// "mount" the new media
+		for _, name := range names {
+			p := filepath.Join(dst, "src", name)
+			if stat, err := os.Lstat(p); err == nil && stat.Mode()&os.ModeSymlink != 0 {
+				os.Remove(p)
+			}
+		}
+		return nil
+	}
+	counter := func(e Event) {
+		if _, ok := e.(*EventNeedMedia); ok {
+			lock.Lock()
+			defer lock.Unlock()
+			events++
+		}
+	}
+
+	// linear targets are not truncated, so the first write fails
+	report := runCopyer(t, WildcardJob(Source(src), Target(dst)), Overwrite(true), WithMediaChange(handler),
+		WithEventHandler(counter), SetTargetDevice(getDevice(root), LinearDevice(true)))
+	if prompts != 1 || events != 1 {
+		t.Fatalf("unexpected media prompts, prompts= %d events= %d", prompts, events)
+	}
+	for _, job := range report.Jobs {
+		if len(job.FailTargets) > 0 {
+			t.Fatalf("unexpected failed job: %+v", job)
+		}
+	}
+	for name, want := range files {
+		got, err := os.ReadFile(filepath.Join(dst, "src", name))
+		if err != nil || !bytes.Equal(got, want) {
+			t.Fatalf("unexpected target %s, len= %d, err= %v", name, len(got), err)
+		}
+	}
+}
+
+func TestMediaChangeDeclined(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "src"), filepath.Join(root, "dst")
+	names := []string{"a.txt", "b.txt", "c.txt"}
+	for _, name := range names {
+		writeTestFile(t, filepath.Join(src, name), name)
+	}
+	prepareFullTargets(t, filepath.Join(dst, "src"), names)
+
+	getDevice, err := getMountpointCache()
+	if err != nil {
+		t.Fatalf("get mount points: %v", err)
+	}
+
+	var lock sync.Mutex
+	var prompts int
+	handler := func(ctx context.Context, e *EventNeedMedia) error {
+		lock.Lock()
+		defer lock.Unlock()
+		prompts++
+		return fmt.Errorf("no more disk")
+	}
+
+	report := runCopyer(t, WildcardJob(Source(src), Target(dst)), Overwrite(true), WithMediaChange(handler),
+		SetTargetDevice(getDevice(root), LinearDevice(true)))
+	if prompts != 1 {
+		t.Fatalf("unexpected media prompts: %d", prompts)
+	}
+	for _, name := range names {
+		job := findReportJob(report, filepath.Join("src", name))
+		if job == nil || len(job.FailTargets) != 1 {
+			t.Fatalf("unexpected job %s: %+v", name, job)
+		}
+	}
+}
+
+func TestMediaChangeKeepsUserPause(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "src"), filepath.Join(root, "dst")
+	writeTestFile(t, filepath.Join(src, "a.bin"), string(bytes.Repeat([]byte{'a'}, 3*batchSize)))
+	prepareFullTargets(t, filepath.Join(dst, "src"), []string{"a.bin"})
+
+	getDevice, err := getMountpointCache()
+	if err != nil {
+		t.Fatalf("get mount points: %v", err)
+	}
+
+	// user pauses copying during the prompt, the file is paused after the current buffer
+	var c *Copyer
+	created := make(chan struct{})
+	handler := func(ctx context.Context, e *EventNeedMedia) error {
+		<-created
+		c.Pause()
+		os.Remove(filepath.Join(dst, "src", "a.bin"))
+		return nil
+	}
+
+	handlerReport, getter := NewReportGetter()
+	c, err = New(context.Background(), WildcardJob(Source(src), Target(dst)), Overwrite(true), WithMediaChange(handler),
+		WithEventHandler(handlerReport), SetTargetDevice(getDevice(root), LinearDevice(true)))
+	if err != nil {
+		t.Fatalf("new copyer: %v", err)
+	}
+	close(created)
+
+	finished := make(chan struct{})
+	go func() {
+		c.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		t.Fatalf("copying is resumed after media changed, while paused by user")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	c.Resume()
+	<-finished
+	if job := findReportJob(getter(), "src/a.bin"); job == nil || len(job.SuccessTargets) != 1 {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+}
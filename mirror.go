@@ -0,0 +1,143 @@
+package acp
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Delete is a file or dir removed from target, which is not in source.
+type Delete struct {
+	Path   string      `json:"path"`
+	Mode   fs.FileMode `json:"mode"`
+	DryRun bool        `json:"dry_run,omitempty"`
+}
+
+// WithDelete delete files and dirs in targets of wildcard jobs which are not in sources, like
+// `rsync --delete`. Files excluded by filters are kept. Deletion is skipped for a wildcard job
+// if some source cannot be walked.
+func WithDelete(b bool) Option {
+	return func(o *option) *option {
+		o.withDelete = b
+		return o
+	}
+}
+
+// WithDeleteDryRun only report files which will be deleted by `WithDelete`, nothing is removed.
+func WithDeleteDryRun(b bool) Option {
+	return func(o *option) *option {
+		o.deleteDryRun = b
+		return o
+	}
+}
+
+type walkedEntry struct {
+	path string
+	dir  bool
+}
+
+// pathKey returns the sort key of path, with which parents are ordered right before children,
+// the same as the depth-first walk order of sorted dirs.
+func pathKey(p string) string {
+	return strings.ReplaceAll(p, "/", "\x00")
+}
+
+// deleteExtraneous removes entries under target roots of job which are not walked from source.
+// Target dirs are walked in the same order as sorted walked entries, so they are merged in one pass.
+func (c *Copyer) deleteExtraneous(ctx context.Context, job *wildcardJob, walked []walkedEntry) {
+	sort.Slice(walked, func(i, j int) bool { return pathKey(walked[i].path) < pathKey(walked[j].path) })
+
+	roots := make([]walkedEntry, 0, len(job.src))
+	for _, src := range job.src {
+		idx := sort.Search(len(walked), func(i int) bool { return pathKey(walked[i].path) >= pathKey(src.path) })
+		if idx < len(walked) && walked[idx].path == src.path && walked[idx].dir {
+			roots = append(roots, walked[idx])
+		}
+	}
+	sort.Slice(roots, func(i, j int) bool { return pathKey(roots[i].path) < pathKey(roots[j].path) })
+
+	for _, dst := range job.dst {
+		idx := 0
+		// filters match paths relative to the source root, the same as walking
+		var merge func(root, rel string, included bool)
+		merge = func(root, rel string, included bool) {
+			if ctx.Err() != nil {
+				return
+			}
+
+			dir := path.Join(dst, rel)
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				if !os.IsNotExist(err) {
+					c.reportError("", dir, fmt.Errorf("delete read target dir fail, %w", err))
+				}
+				return
+			}
+
+			for _, entry := range entries {
+				child := path.Join(rel, entry.Name())
+				key := pathKey(child)
+				for idx < len(walked) && pathKey(walked[idx].path) < key {
+					idx++
+				}
+
+				fi, err := entry.Info()
+				if err != nil {
+					c.reportError("", path.Join(dst, child), fmt.Errorf("delete get target stat fail, %w", err))
+					continue
+				}
+
+				keep, included := job.filter.match(filterPath(root, child, fi.IsDir()), fi, included)
+				if !keep {
+					continue
+				}
+
+				if idx < len(walked) && walked[idx].path == child && walked[idx].dir == fi.IsDir() {
+					if fi.IsDir() {
+						merge(root, child, included)
+					}
+					continue
+				}
+
+				c.deleteTarget(path.Join(dst, child), fi)
+			}
+		}
+
+		for _, root := range roots {
+			merge(root.path, root.path, false)
+		}
+	}
+}
+
+// deleteTarget removes the target, children of dir are removed and reported before it.
+func (c *Copyer) deleteTarget(target string, fi fs.FileInfo) {
+	if fi.IsDir() {
+		entries, err := os.ReadDir(target)
+		if err != nil {
+			c.reportError("", target, fmt.Errorf("delete read target dir fail, %w", err))
+			return
+		}
+
+		for _, entry := range entries {
+			child, err := entry.Info()
+			if err != nil {
+				c.reportError("", path.Join(target, entry.Name()), fmt.Errorf("delete get target stat fail, %w", err))
+				continue
+			}
+			c.deleteTarget(path.Join(target, entry.Name()), child)
+		}
+	}
+
+	if !c.deleteDryRun {
+		if err := os.Remove(target); err != nil {
+			c.reportError("", target, fmt.Errorf("delete target fail, %w", err))
+			return
+		}
+	}
+
+	c.submit(&EventDelete{&Delete{Path: target, Mode: fi.Mode(), DryRun: c.deleteDryRun}})
+}
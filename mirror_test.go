@@ -0,0 +1,93 @@
+package acp
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestDeleteExtraneous(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "src"), filepath.Join(root, "dst")
+	writeTestFile(t, filepath.Join(src, "keep.txt"), "keep")
+	writeTestFile(t, filepath.Join(src, "sub", "keep.txt"), "keep")
+	writeTestFile(t, filepath.Join(dst, "src", "keep.txt"), "keep")
+	writeTestFile(t, filepath.Join(dst, "src", "extra.txt"), "extra")
+	writeTestFile(t, filepath.Join(dst, "src", "extra-dir", "a.txt"), "extra")
+	writeTestFile(t, filepath.Join(dst, "src", "sub", "extra.txt"), "extra")
+	writeTestFile(t, filepath.Join(dst, "src", "sub", "excluded.log"), "excluded")
+	writeTestFile(t, filepath.Join(dst, "other.txt"), "not in source root")
+
+	wantDeleted := []string{
+		filepath.Join(dst, "src", "extra-dir"),
+		filepath.Join(dst, "src", "extra-dir", "a.txt"),
+		filepath.Join(dst, "src", "extra.txt"),
+		filepath.Join(dst, "src", "sub", "extra.txt"),
+	}
+
+	job := WildcardJob(Source(src), Target(dst), Exclude("*.log"))
+	report := runCopyer(t, job, UpdatePolicy(UpdateSizeMtime), WithDeleteDryRun(true))
+	if got := deletedPaths(report); !reflect.DeepEqual(got, wantDeleted) {
+		t.Fatalf("unexpected dry run deletes: %v", got)
+	}
+	for _, p := range wantDeleted {
+		if _, err := os.Lstat(p); err != nil {
+			t.Fatalf("file is deleted in dry run: %v", err)
+		}
+	}
+
+	report = runCopyer(t, job, UpdatePolicy(UpdateSizeMtime), WithDelete(true))
+	if len(report.Errors) > 0 {
+		t.Fatalf("unexpected errors: %v", report.Errors[0])
+	}
+	if got := deletedPaths(report); !reflect.DeepEqual(got, wantDeleted) {
+		t.Fatalf("unexpected deletes: %v", got)
+	}
+	for _, p := range wantDeleted {
+		if _, err := os.Lstat(p); !os.IsNotExist(err) {
+			t.Fatalf("extraneous file is not deleted: %s, %v", p, err)
+		}
+	}
+	for _, p := range []string{"src/keep.txt", "src/sub/keep.txt", "src/sub/excluded.log", "other.txt"} {
+		if _, err := os.Lstat(filepath.Join(dst, p)); err != nil {
+			t.Fatalf("file should be kept: %s, %v", p, err)
+		}
+	}
+}
+
+func TestDeleteExtraneousAnchoredExclude(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "src"), filepath.Join(root, "dst")
+	writeTestFile(t, filepath.Join(src, "top.txt"), "top")
+	writeTestFile(t, filepath.Join(src, "sub", "top.txt"), "top")
+	writeTestFile(t, filepath.Join(src, "sub", "x", "a.txt"), "a")
+	writeTestFile(t, filepath.Join(dst, "src", "top.txt"), "excluded")
+	writeTestFile(t, filepath.Join(dst, "src", "sub", "x", "a.txt"), "excluded")
+	writeTestFile(t, filepath.Join(dst, "src", "sub", "extra.txt"), "extra")
+
+	// excluded files are kept, patterns are matched relative to the source root
+	job := WildcardJob(Source(src), Target(dst), Exclude("/top.txt", "sub/x"))
+	report := runCopyer(t, job, WithDelete(true))
+	if len(report.Errors) > 0 {
+		t.Fatalf("unexpected errors: %v", report.Errors[0])
+	}
+	if got, want := deletedPaths(report), []string{filepath.Join(dst, "src", "sub", "extra.txt")}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected deletes: %v", got)
+	}
+	for p, want := range map[string]string{"src/top.txt": "excluded", "src/sub/x/a.txt": "excluded", "src/sub/top.txt": "top"} {
+		if got, err := os.ReadFile(filepath.Join(dst, p)); err != nil || string(got) != want {
+			t.Fatalf("unexpected target %s: %q, %v", p, got, err)
+		}
+	}
+}
+
+func deletedPaths(report *Report) []string {
+	paths := make([]string, 0, len(report.Deletes))
+	for _, d := range report.Deletes {
+		paths = append(paths, d.Path)
+	}
+	sort.Strings(paths)
+	return paths
+}
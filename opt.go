@@ -1,9 +1,11 @@
 package acp
 
 import (
+	"fmt"
 	"os"
 	"path"
 
+	"github.com/samber/lo"
 	"github.com/sirupsen/logrus"
 )
 
@@ -28,11 +30,35 @@ type option struct {
 	accurateJobs []*accurateJob
 	wildcardJobs []*wildcardJob
 
-	fromDevice *deviceOption
-	toDevice   *deviceOption
+	fromDevice    *deviceOption
+	toDevice      *deviceOption
+	targetDevices map[string][]DeviceOption
+
+	// options of target devices set by SetTargetDevice, resolved in check
+	targetDeviceOpts map[string]*deviceOption
 
 	createFlag int
 	withHash   bool
+	hashes     []string
+	withVerify bool
+	resumeJobs map[string]*Job
+	updateMode UpdateMode
+	retry      *RetryPolicy
+
+	mediaHandler MediaChangeHandler
+
+	dryRun       bool
+	archive      *archiveTarget
+	withDelete   bool
+	deleteDryRun bool
+
+	preserveLinks bool
+	specialFiles  bool
+	emptyDirs     bool
+	hardLinks     bool
+	sparse        bool
+	reflink       ReflinkMode
+	atomicWrite   bool
 
 	logger       *logrus.Logger
 	eventHanders []EventHandler
@@ -43,6 +69,7 @@ func newOption() *option {
 		fromDevice: new(deviceOption),
 		toDevice:   new(deviceOption),
 		createFlag: os.O_WRONLY | os.O_CREATE | os.O_EXCL,
+		sparse:     true,
 	}
 }
 
@@ -55,10 +82,71 @@ func (o *option) check() error {
 
 	o.fromDevice.check()
 	o.toDevice.check()
-	if o.fromDevice.linear || o.toDevice.linear {
+	if o.archive != nil {
+		for _, job := range o.wildcardJobs {
+			if len(job.tars) > 0 {
+				return fmt.Errorf("tar source cannot be used with tar target")
+			}
+		}
+		if err := o.archive.check(); err != nil {
+			return err
+		}
+	}
+	if o.fromDevice.linear || o.toDevice.linear || o.archive != nil {
 		o.fromDevice.threads = 1
 		o.toDevice.threads = 1
 	}
+	o.targetDeviceOpts = make(map[string]*deviceOption, len(o.targetDevices))
+	for mountPoint, opts := range o.targetDevices {
+		// bandwidth of to device is shared by all devices, so it is not inherited
+		do := &deviceOption{linear: o.toDevice.linear, threads: o.toDevice.threads, buffer: o.toDevice.buffer}
+		for _, opt := range opts {
+			if opt == nil {
+				continue
+			}
+			do = opt(do)
+		}
+		do.check()
+		o.targetDeviceOpts[mountPoint] = do
+	}
+	// readers submit files to devices by turns, so a linear target device gets files in sorted order
+	// only if there is one reader
+	if lo.ContainsBy(lo.Values(o.targetDeviceOpts), func(do *deviceOption) bool { return do.linear }) {
+		o.fromDevice.threads = 1
+		o.toDevice.threads = 1
+	}
+	if o.withDelete && lo.ContainsBy(o.wildcardJobs, func(job *wildcardJob) bool { return job.span != nil }) {
+		return fmt.Errorf("delete cannot be used with span target")
+	}
+	if o.retry != nil {
+		o.retry.check()
+	}
+	if o.dryRun && o.withDelete {
+		o.deleteDryRun = true
+	}
+	if o.deleteDryRun {
+		o.withDelete = true
+	}
+	if o.withDelete && lo.ContainsBy(o.wildcardJobs, func(job *wildcardJob) bool { return len(job.tars) > 0 }) {
+		return fmt.Errorf("delete cannot be used with tar source")
+	}
+	if o.updateMode == UpdateChecksum && o.fromDevice.linear {
+		return fmt.Errorf("checksum update cannot be used with linear from device, sources are hashed while indexing")
+	}
+	if o.updateMode != 0 {
+		o.createFlag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	if o.withVerify && len(o.hashes) == 0 {
+		o.withHash = true
+	}
+	if o.withHash && !lo.Contains(o.hashes, HashSHA256) {
+		o.hashes = append([]string{HashSHA256}, o.hashes...)
+	}
+	for _, name := range o.hashes {
+		if err := checkHash(name); err != nil {
+			return err
+		}
+	}
 	if o.logger == nil {
 		o.logger = logrus.StandardLogger()
 	}
@@ -127,6 +215,40 @@ func WithHash(b bool) Option {
 	}
 }
 
+// WithPreserveLinks recreate symbolic links verbatim on targets. By default, symbolic links
+// are dereferenced, and the files or dirs they point to are copied.
+func WithPreserveLinks(b bool) Option {
+	return func(o *option) *option {
+		o.preserveLinks = b
+		return o
+	}
+}
+
+// WithSpecialFiles recreate fifos and device files on targets, creating device files requires root.
+func WithSpecialFiles(b bool) Option {
+	return func(o *option) *option {
+		o.specialFiles = b
+		return o
+	}
+}
+
+// WithEmptyDirs recreate empty dirs on targets, which are dropped by default.
+func WithEmptyDirs(b bool) Option {
+	return func(o *option) *option {
+		o.emptyDirs = b
+		return o
+	}
+}
+
+// WithHardLinks keep hard links of source on targets, a file with multiple links in source
+// is copied only once, and other paths are linked to it on targets.
+func WithHardLinks(b bool) Option {
+	return func(o *option) *option {
+		o.hardLinks = b
+		return o
+	}
+}
+
 func WithLogger(logger *logrus.Logger) Option {
 	return func(o *option) *option {
 		o.logger = logger
@@ -1,17 +1,38 @@
 package acp
 
+import (
+	"path"
+
+	"github.com/samber/lo"
+)
+
+const (
+	defaultDeviceThreads = 8
+	defaultDeviceBuffer  = 16 * batchSize
+)
+
 type deviceOption struct {
-	linear  bool
-	threads int
+	linear    bool
+	threads   int
+	bandwidth int64
+	buffer    int64
 }
 
 func (do *deviceOption) check() {
 	if do.threads == 0 {
-		do.threads = 8
+		do.threads = defaultDeviceThreads
 	}
 	if do.linear {
 		do.threads = 1
 	}
+	if do.buffer <= 0 {
+		do.buffer = defaultDeviceBuffer
+	}
+}
+
+// bufferChunks returns how many chunks can be buffered for one file written to the device.
+func (do *deviceOption) bufferChunks() int {
+	return lo.Max([]int{int(do.buffer / batchSize), 1})
 }
 
 type DeviceOption func(*deviceOption) *deviceOption
@@ -29,3 +50,44 @@ func DeviceThreads(threads int) DeviceOption {
 		return d
 	}
 }
+
+// DeviceBuffer sets bytes of chunks buffered for each file written to a target device, so
+// a slow device may fall behind the reader by the buffer, without blocking other devices.
+// Memory used by a device is at most buffer * threads. Default is 16MB.
+func DeviceBuffer(bytes int64) DeviceOption {
+	return func(d *deviceOption) *deviceOption {
+		d.buffer = bytes
+		return d
+	}
+}
+
+// SetTargetDevice sets options of the target device mounted at mountPoint, targets on other devices
+// use options from SetToDevice. Bandwidth of SetToDevice is shared by all devices, bandwidth set
+// here only limits this device. A linear device makes sources read by one reader, to keep the sorted order.
+func SetTargetDevice(mountPoint string, opts ...DeviceOption) Option {
+	return func(o *option) *option {
+		if o.targetDevices == nil {
+			o.targetDevices = make(map[string][]DeviceOption)
+		}
+
+		mountPoint = path.Clean(mountPoint)
+		o.targetDevices[mountPoint] = append(o.targetDevices[mountPoint], opts...)
+		return o
+	}
+}
+
+// deviceOption returns options of the target device, by the mount point from getDevice.
+func (c *Copyer) deviceOption(dev string) *deviceOption {
+	if do, ok := c.targetDeviceOpts[path.Clean(dev)]; ok {
+		return do
+	}
+	return c.toDevice
+}
+
+// linearTarget returns whether target is on a linear device.
+func (c *Copyer) linearTarget(target string) bool {
+	if len(c.targetDeviceOpts) == 0 {
+		return c.toDevice.linear
+	}
+	return c.deviceOption(c.getDevice(target)).linear
+}
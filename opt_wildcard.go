@@ -9,8 +9,12 @@ import (
 )
 
 type wildcardJob struct {
-	src []*source
-	dst []string
+	src    []*source
+	tars   []*tarSource
+	dst    []string
+	span   *spanVolumes
+	filter *fileFilter
+	order  SourceOrder
 }
 
 func (job *wildcardJob) check() error {
@@ -35,10 +39,24 @@ func (job *wildcardJob) check() error {
 		filteredDst = append(filteredDst, p)
 	}
 	job.dst = filteredDst
+	if job.span != nil {
+		if err := job.span.check(); err != nil {
+			return err
+		}
+	}
+
+	if err := job.filter.check(); err != nil {
+		return err
+	}
 
-	if len(job.src) == 0 {
+	if len(job.src) == 0 && len(job.tars) == 0 {
 		return fmt.Errorf("source path not found")
 	}
+	for _, t := range job.tars {
+		if err := t.check(); err != nil {
+			return err
+		}
+	}
 	sort.Slice(job.src, func(i, j int) bool {
 		si, sj := strings.ReplaceAll(job.src[i].path, "/", "\x00"), strings.ReplaceAll(job.src[j].path, "/", "\x00")
 		return si < sj
@@ -60,7 +78,7 @@ func WildcardJob(opts ...WildcardJobOption) Option {
 			j = opt(j)
 		}
 
-		if len(j.src) == 0 {
+		if len(j.src) == 0 && len(j.tars) == 0 {
 			return o
 		}
 
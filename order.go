@@ -0,0 +1,88 @@
+package acp
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+type SourceOrder int
+
+const (
+	// OrderByPath reads sources in path order, which is the write order of LTFS on tape
+	OrderByPath SourceOrder = iota
+	// OrderByInode reads sources in inode order, which is close to the disk order on many file systems
+	OrderByInode
+	// OrderByExtent reads sources in the order of their first physical extent, by FIEMAP on linux.
+	// Files without extent info are read after, in inode order.
+	OrderByExtent
+)
+
+var sourceOrderNames = map[string]SourceOrder{
+	"path":   OrderByPath,
+	"inode":  OrderByInode,
+	"extent": OrderByExtent,
+}
+
+// ParseSourceOrder parses source order from name, can be 'path', 'inode' or 'extent'.
+func ParseSourceOrder(name string) (SourceOrder, error) {
+	order, has := sourceOrderNames[name]
+	if !has {
+		return OrderByPath, fmt.Errorf("unexpected source order, '%s'", name)
+	}
+	return order, nil
+}
+
+// SourceOrderBy sets the read order of files in the wildcard job, default is path order.
+// Reading in physical order may be much faster on spinning disks. Targets get the same
+// order, and hard links are still copied after the files they link to.
+func SourceOrderBy(order SourceOrder) WildcardJobOption {
+	return func(j *wildcardJob) *wildcardJob {
+		j.order = order
+		return j
+	}
+}
+
+type orderKey struct {
+	dev      uint64
+	unmapped bool
+	pos      uint64
+}
+
+func (k orderKey) less(o orderKey) bool {
+	if k.dev != o.dev {
+		return k.dev < o.dev
+	}
+	if k.unmapped != o.unmapped {
+		return !k.unmapped
+	}
+	return k.pos < o.pos
+}
+
+// orderJobs sorts jobs in path order by the source order, jobs of the same key keep path order,
+// so hard links, which have the same inode and extent, are after the files they link to.
+func (c *Copyer) orderJobs(jobs []*baseJob, order SourceOrder) {
+	if order == OrderByPath {
+		return
+	}
+
+	keys := make(map[*baseJob]orderKey, len(jobs))
+	for _, job := range jobs {
+		dev, ino, _ := getInode(job.stat)
+		key := orderKey{dev: dev, unmapped: true, pos: ino}
+		if order == OrderByExtent && job.stat.mode.IsRegular() && job.stat.size > 0 {
+			physical, err := firstPhysicalExtent(job.path)
+			if err == nil {
+				key.unmapped, key.pos = false, physical
+			} else {
+				c.logf(logrus.DebugLevel, "get physical extent fail, path= '%s', %s", job.path, err)
+			}
+		}
+		keys[job] = key
+	}
+
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return keys[jobs[i]].less(keys[jobs[j]])
+	})
+}
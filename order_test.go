@@ -0,0 +1,98 @@
+package acp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOrderJobs(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "src")
+	for idx := 0; idx < 9; idx++ {
+		writeTestFile(t, filepath.Join(src, fmt.Sprintf("%d.txt", idx)), strings.Repeat(fmt.Sprint(idx), 4096*(9-idx)))
+	}
+	if err := os.Link(filepath.Join(src, "0.txt"), filepath.Join(src, "9.txt")); err != nil {
+		t.Fatalf("link: %v", err)
+	}
+
+	opt := newOption()
+	if err := opt.check(); err != nil {
+		t.Fatalf("check option: %v", err)
+	}
+	c := &Copyer{option: opt}
+
+	newJobs := func() []*baseJob {
+		jobs := make([]*baseJob, 0, 10)
+		for idx := 0; idx < 10; idx++ {
+			path := filepath.Join(src, fmt.Sprintf("%d.txt", idx))
+			fi, err := os.Stat(path)
+			if err != nil {
+				t.Fatalf("stat: %v", err)
+			}
+			st, err := newStat(path, fi)
+			if err != nil {
+				t.Fatalf("new stat: %v", err)
+			}
+			jobs = append(jobs, &baseJob{src: &source{base: root, path: filepath.Join("src", fi.Name())}, path: path, stat: st})
+		}
+		return jobs
+	}
+
+	jobs := newJobs()
+	c.orderJobs(jobs, OrderByInode)
+	for idx := 1; idx < len(jobs); idx++ {
+		_, prev, ok := getInode(jobs[idx-1].stat)
+		if !ok {
+			t.Skip("inode is not supported")
+		}
+		_, ino, _ := getInode(jobs[idx].stat)
+		if prev > ino {
+			t.Fatalf("unexpected inode order, %d > %d", prev, ino)
+		}
+	}
+
+	jobs = newJobs()
+	c.orderJobs(jobs, OrderByExtent)
+	var last uint64
+	for idx, job := range jobs {
+		physical, err := firstPhysicalExtent(job.path)
+		if err != nil {
+			t.Skipf("physical extent is not supported, %v", err)
+		}
+		if physical < last {
+			t.Fatalf("unexpected extent order, %d < %d", physical, last)
+		}
+		last = physical
+
+		// hard link keeps after the file it links to
+		if job.src.path == filepath.Join("src", "9.txt") && (idx == 0 || jobs[idx-1].src.path != filepath.Join("src", "0.txt")) {
+			t.Fatalf("hard link is not after the linked file, idx= %d", idx)
+		}
+	}
+}
+
+func TestSourceOrderCopy(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "src"), filepath.Join(root, "dst")
+	files := make(map[string]string)
+	for idx := 0; idx < 5; idx++ {
+		name := fmt.Sprintf("%d.txt", idx)
+		files[name] = strings.Repeat(name, idx*100)
+		writeTestFile(t, filepath.Join(src, name), files[name])
+	}
+	mkdirTest(t, dst)
+
+	report := runCopyer(t, WildcardJob(Source(src), Target(dst), SourceOrderBy(OrderByExtent)))
+	if len(report.Errors) > 0 {
+		t.Fatalf("unexpected errors: %v", report.Errors[0])
+	}
+	for name, want := range files {
+		got, err := os.ReadFile(filepath.Join(dst, "src", name))
+		if err != nil || string(got) != want {
+			t.Fatalf("unexpected target %s: %q, %v", name, got, err)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package acp
+
+import (
+	"context"
+	"os"
+	"sort"
+)
+
+const (
+	PlanCreate    = "create"
+	PlanOverwrite = "overwrite"
+	PlanSkip      = "skip"
+	PlanConflict  = "conflict"
+	PlanNoSpace   = "no-space"
+)
+
+// PlanDevice is the space planned to be written to a target device.
+type PlanDevice struct {
+	Device string `json:"device"`
+	Need   int64  `json:"need"`
+	Free   int64  `json:"free"`
+}
+
+// WithDryRun only walk sources and plan what will be done on each target, such like create,
+// overwrite, skip, conflict or no-space, no target file is opened for writing.
+// Planned actions are reported in `Job.PlanTargets`, and space of devices in `EventPlanDevice`.
+func WithDryRun(b bool) Option {
+	return func(o *option) *option {
+		o.dryRun = b
+		return o
+	}
+}
+
+func (c *Copyer) plan(ctx context.Context, indexed <-chan *baseJob) {
+	defer func() {
+		devices := make([]*PlanDevice, 0, len(c.planDevices))
+		for _, d := range c.planDevices {
+			devices = append(devices, d)
+		}
+		sort.Slice(devices, func(i, j int) bool { return devices[i].Device < devices[j].Device })
+
+		for _, d := range devices {
+			c.submit(&EventPlanDevice{Device: d})
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job, ok := <-indexed:
+			if !ok {
+				return
+			}
+
+			c.planJob(job)
+			job.setStatus(jobStatusPlanned)
+		}
+	}
+}
+
+// planJob decides actions of each target of job, the same way as they are written.
+func (c *Copyer) planJob(job *baseJob) {
+	plans := make(map[string]string, len(job.targets)+len(job.successTargets)+len(job.skipTargets))
+	for _, target := range job.successTargets {
+		plans[target] = PlanSkip
+	}
+	for _, target := range job.skipTargets {
+		plans[target] = PlanSkip
+	}
+
+	// holes of sparse files take no space, the same as checking space while copying
+	var size int64
+	if job.hasData() {
+		var extents []extent
+		if job.stream == nil {
+			extents = c.sparseExtents(job.path, job.stat)
+		}
+		size = physicalSize(job.stat.size, extents)
+	}
+	if job.span != nil && job.getVolume() == "" {
+		if job.linkTo != nil {
+			job.linkSpan()
+		} else if !c.planSpanVolume(job, size) {
+			plans[job.src.dst(job.span.volumes[len(job.span.volumes)-1])] = PlanNoSpace
+		}
+	}
+
+	for _, target := range job.targets {
+		fi, err := os.Lstat(target)
+		exists := err == nil
+		switch {
+		case exists && job.stat.mode.IsDir() && fi.IsDir():
+			plans[target] = PlanSkip
+			continue
+		case exists && (c.createFlag&os.O_EXCL != 0 || fi.IsDir()):
+			plans[target] = PlanConflict
+			continue
+		}
+
+		if job.hasData() && !c.planSpace(target, size) {
+			plans[target] = PlanNoSpace
+			continue
+		}
+
+		if exists {
+			plans[target] = PlanOverwrite
+			continue
+		}
+		plans[target] = PlanCreate
+	}
+
+	job.lock.Lock()
+	job.planTargets = plans
+	job.lock.Unlock()
+}
+
+// planSpanVolume chooses the volume of span job the same as spanTarget, by planned space of devices
+// instead of writing. Returns false if all volumes are full.
+func (c *Copyer) planSpanVolume(job *baseJob, size int64) bool {
+	s := job.span
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for ; s.current < len(s.volumes); s.current, s.used = s.current+1, 0 {
+		volume := s.volumes[s.current]
+		if s.size > 0 && s.used+size > s.size {
+			if s.used == 0 {
+				// file larger than a volume never fits
+				break
+			}
+			continue
+		}
+
+		device := c.planDevice(volume)
+		if device.Need+size > device.Free {
+			continue
+		}
+
+		s.used += size
+		job.setVolume(volume)
+		return true
+	}
+	return false
+}
+
+// planSpace adds size to the planned space of target device, returns false if there is no enough space.
+func (c *Copyer) planSpace(target string, size int64) bool {
+	device := c.planDevice(target)
+	device.Need += size
+	return device.Need <= device.Free
+}
+
+// planDevice returns the planned space of target device, free space is read at the first time.
+func (c *Copyer) planDevice(target string) *PlanDevice {
+	dev := c.getDevice(target)
+	if c.planDevices == nil {
+		c.planDevices = make(map[string]*PlanDevice, 4)
+	}
+
+	device, has := c.planDevices[dev]
+	if !has {
+		free, err := c.getDiskUsageCache(dev).available()
+		if err != nil {
+			c.reportError("", target, err)
+		}
+
+		device = &PlanDevice{Device: dev, Free: free}
+		c.planDevices[dev] = device
+	}
+	return device
+}
@@ -0,0 +1,98 @@
+package acp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDryRunPlan(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "src"), filepath.Join(root, "dst")
+	writeTestFile(t, filepath.Join(src, "new.txt"), "new")
+	writeTestFile(t, filepath.Join(src, "exists.txt"), "exists")
+	writeTestFile(t, filepath.Join(dst, "src", "exists.txt"), "old")
+
+	cases := []struct {
+		opts  []Option
+		plans map[string]string
+		need  int64
+	}{
+		{nil, map[string]string{"new.txt": PlanCreate, "exists.txt": PlanConflict}, 3},
+		{[]Option{Overwrite(true)}, map[string]string{"new.txt": PlanCreate, "exists.txt": PlanOverwrite}, 9},
+	}
+	for _, tc := range cases {
+		opts := append([]Option{WildcardJob(Source(src), Target(dst)), WithDryRun(true)}, tc.opts...)
+		report := runCopyer(t, opts...)
+		if len(report.Errors) > 0 {
+			t.Fatalf("unexpected errors: %v", report.Errors[0])
+		}
+
+		for name, want := range tc.plans {
+			job := findReportJob(report, "src/"+name)
+			target := filepath.Join(dst, "src", name)
+			if job == nil || job.Status != JobStatusPlanned || job.PlanTargets[target] != want {
+				t.Fatalf("unexpected plan of %s, want %s: %+v", name, want, job)
+			}
+		}
+		if len(report.PlanDevices) != 1 || report.PlanDevices[0].Need != tc.need {
+			t.Fatalf("unexpected plan devices: %s", report.ToJSONString(false))
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dst, "src", "new.txt")); !os.IsNotExist(err) {
+		t.Fatalf("target is written in dry run: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(dst, "src", "exists.txt"))
+	if err != nil || string(got) != "old" {
+		t.Fatalf("target is changed in dry run: %q, %v", got, err)
+	}
+}
+
+func TestDryRunSpan(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "src")
+	volumes := []string{filepath.Join(root, "vol1"), filepath.Join(root, "vol2")}
+	mkdirTest(t, volumes...)
+	for idx := 0; idx < 5; idx++ {
+		writeTestFile(t, filepath.Join(src, fmt.Sprintf("%d.txt", idx)), strings.Repeat(fmt.Sprint(idx), 100))
+	}
+
+	// each volume holds two files, the last one has no space
+	report := runCopyer(t, WildcardJob(Source(src), SpanTarget(volumes...), SpanVolumeSize(250)), WithDryRun(true))
+	if len(report.Errors) > 0 {
+		t.Fatalf("unexpected errors: %v", report.Errors[0])
+	}
+
+	counts := make(map[string]int)
+	var noSpace int
+	for _, job := range report.Jobs {
+		if job.Mode.IsDir() {
+			continue
+		}
+		if job.Volume == "" {
+			if job.PlanTargets[filepath.Join(volumes[1], job.Path)] != PlanNoSpace {
+				t.Fatalf("unexpected plan of job without volume: %+v", job)
+			}
+			noSpace++
+			continue
+		}
+
+		target := filepath.Join(job.Volume, job.Path)
+		if len(job.PlanTargets) != 1 || job.PlanTargets[target] != PlanCreate {
+			t.Fatalf("unexpected plan of span job: %+v", job)
+		}
+		if _, err := os.Stat(target); !os.IsNotExist(err) {
+			t.Fatalf("target is written in dry run: %v", err)
+		}
+		counts[job.Volume]++
+	}
+	if noSpace != 1 || len(counts) != 2 {
+		t.Fatalf("unexpected planned volumes, no space= %d, counts= %v", noSpace, counts)
+	}
+	if len(report.PlanDevices) != 1 || report.PlanDevices[0].Need != 400 {
+		t.Fatalf("unexpected plan devices: %s", report.ToJSONString(false))
+	}
+}
@@ -2,12 +2,8 @@ package acp
 
 import (
 	"context"
-	"fmt"
-	"io"
-	"os"
+	"errors"
 	"sync"
-
-	"github.com/samuelncui/acp/mmap"
 )
 
 func (c *Copyer) prepare(ctx context.Context, indexed <-chan *baseJob) <-chan *writeJob {
@@ -39,41 +35,41 @@ func (c *Copyer) prepare(ctx context.Context, indexed <-chan *baseJob) <-chan *w
 						return
 					}
 
-					job.setStatus(jobStatusPreparing)
-
-					file, size, err := func(path string) (io.ReadCloser, int64, error) {
-						if c.fromDevice.linear {
-							file, err := os.Open(path)
-							if err != nil {
-								return nil, 0, fmt.Errorf("open src file fail, %w", err)
-							}
-
-							fileInfo, err := file.Stat()
-							if err != nil {
-								return nil, 0, fmt.Errorf("get src file stat fail, %w", err)
-							}
-							if fileInfo.Size() == 0 {
-								return nil, 0, fmt.Errorf("get src file, size is zero")
-							}
-
-							return file, fileInfo.Size(), nil
+					// stopped jobs keep pending, the rest of indexed jobs are drained
+					if c.isStopping() {
+						if job.stream != nil {
+							job.stream.Close()
 						}
-
-						readerAt, err := mmap.Open(path)
-						if err != nil {
-							return nil, 0, fmt.Errorf("open src file by mmap fail, %w", err)
-						}
-						if readerAt.Len() == 0 {
-							return nil, 0, fmt.Errorf("get src file by mmap, size is zero")
+						continue
+					}
+					if err := c.waitControl(ctx, job); err != nil {
+						if errors.Is(err, ErrJobCanceled) {
+							c.failJob(job, ErrJobCanceled)
+							continue
 						}
+						return
+					}
+
+					job.setStatus(jobStatusPreparing)
+					if !job.hasData() {
+						ch <- newWriteJob(job, nil, 0, false)
+						continue
+					}
+					if job.stream != nil {
+						ch <- newWriteJob(job, job.stream, job.stat.size, false)
+						continue
+					}
 
-						return mmap.NewReader(readerAt), int64(readerAt.Len()), nil
-					}(job.path)
+					// targets of source which cannot be opened are failed, instead of written as empty files
+					file, size, err := c.openSource(ctx, job)
 					if err != nil {
 						c.reportError(job.path, "", err)
+						c.failJob(job, err)
+						continue
 					}
 
 					wj := newWriteJob(job, file, size, c.fromDevice.linear)
+					wj.extents = c.sparseExtents(job.path, job.stat)
 					ch <- wj
 					wj.wait()
 				}
@@ -83,3 +79,14 @@ func (c *Copyer) prepare(ctx context.Context, indexed <-chan *baseJob) <-chan *w
 
 	return ch
 }
+
+// failJob finishes a job which cannot be opened, all targets are failed by err.
+func (c *Copyer) failJob(job *baseJob, err error) {
+	if job.stream != nil {
+		job.stream.Close()
+	}
+	for _, target := range job.targets {
+		job.fail(target, err)
+	}
+	job.setStatus(jobStatusFinished)
+}
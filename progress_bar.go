@@ -24,16 +24,42 @@ func NewProgressBar() EventHandler {
 		progressbar.OptionSetRenderBlankState(true),
 	)
 
-	var totalFiles int64
+	var totalFiles, files int64
+	state, media := StateRunning, ""
+	describeState := func() bool {
+		switch state {
+		case StatePaused:
+			if media != "" {
+				bar.Describe(fmt.Sprintf("[%d/%d] waiting for new media of '%s'", files, totalFiles, media))
+				break
+			}
+
+			bar.Describe(fmt.Sprintf("[%d/%d] paused", files, totalFiles))
+		case StateStopping:
+			bar.Describe(fmt.Sprintf("[%d/%d] stopping...", files, totalFiles))
+		default:
+			return false
+		}
+		return true
+	}
+
 	return func(ev Event) {
 		switch e := ev.(type) {
 		case *EventUpdateCount:
 			totalFiles = e.Files
-			bar.Describe(fmt.Sprintf("[0/%d] indexing...", totalFiles))
+			if e.Skipped > 0 {
+				bar.Describe(fmt.Sprintf("[0/%d] indexing, %d skipped...", totalFiles, e.Skipped))
+			} else {
+				bar.Describe(fmt.Sprintf("[0/%d] indexing...", totalFiles))
+			}
 			bar.ChangeMax64(e.Bytes)
 			return
 		case *EventUpdateProgress:
 			bar.Set64(e.Bytes)
+			files = e.Files
+			if describeState() {
+				return
+			}
 
 			if !e.Finished {
 				bar.Describe(fmt.Sprintf("[%d/%d] copying...", e.Files, totalFiles))
@@ -42,6 +68,19 @@ func NewProgressBar() EventHandler {
 
 			bar.Describe(fmt.Sprintf("[%d/%d] finishing...", e.Files, totalFiles))
 			return
+		case *EventNeedMedia:
+			media = e.Device
+			describeState()
+			return
+		case *EventStateChange:
+			state = e.State
+			if state != StatePaused {
+				media = ""
+			}
+			if !describeState() {
+				bar.Describe(fmt.Sprintf("[%d/%d] copying...", files, totalFiles))
+			}
+			return
 		default:
 			return
 		}
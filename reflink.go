@@ -0,0 +1,85 @@
+package acp
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sirupsen/logrus"
+)
+
+type ReflinkMode int
+
+const (
+	// ReflinkNever always copy data by streaming
+	ReflinkNever ReflinkMode = iota
+	// ReflinkAuto try reflink when source and target are on the same device, fallback to streaming
+	ReflinkAuto
+	// ReflinkAlways fail the target if reflink cannot be done
+	ReflinkAlways
+)
+
+var (
+	ErrReflinkUnsupported = fmt.Errorf("acp: reflink unsupported")
+)
+
+var reflinkModeNames = map[string]ReflinkMode{
+	"never":  ReflinkNever,
+	"auto":   ReflinkAuto,
+	"always": ReflinkAlways,
+}
+
+// ParseReflinkMode parses reflink mode from name, can be 'never', 'auto' or 'always'.
+func ParseReflinkMode(name string) (ReflinkMode, error) {
+	mode, has := reflinkModeNames[name]
+	if !has {
+		return ReflinkNever, fmt.Errorf("unexpected reflink mode, '%s'", name)
+	}
+	return mode, nil
+}
+
+// WithReflink clone files by FICLONE or copy_file_range when source and target are on the same
+// file system, then data is not copied by acp. Source is still read once if hash is needed.
+func WithReflink(mode ReflinkMode) Option {
+	return func(o *option) *option {
+		o.reflink = mode
+		return o
+	}
+}
+
+// reflinkTarget tries to clone source of job into the opened target file. It returns false
+// without error if the target should fallback to streaming.
+func (c *Copyer) reflinkTarget(job *writeJob, file *os.File, dev string) (bool, error) {
+	if c.getDevice(job.path) != dev {
+		if c.reflink == ReflinkAlways {
+			return false, fmt.Errorf("%w, source and target are on different devices", ErrReflinkUnsupported)
+		}
+		return false, nil
+	}
+
+	src, err := os.Open(job.path)
+	if err != nil {
+		return false, fmt.Errorf("open src file fail, %w", err)
+	}
+	defer src.Close()
+
+	if err := cloneFile(file, src, job.size); err != nil {
+		if c.reflink == ReflinkAlways {
+			return false, err
+		}
+
+		c.logf(logrus.DebugLevel, "reflink fail, fallback to stream copy, path= '%s', %s", job.path, err)
+		if err := file.Truncate(0); err != nil {
+			return false, fmt.Errorf("truncate dst file fail, %w", err)
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return false, fmt.Errorf("seek dst file fail, %w", err)
+		}
+		return false, nil
+	}
+
+	if err := file.Sync(); err != nil {
+		return false, fmt.Errorf("sync dst file fail, %w", err)
+	}
+	return true, nil
+}
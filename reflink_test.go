@@ -0,0 +1,50 @@
+package acp
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCopyWithReflink(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "src"), filepath.Join(root, "dst")
+	content := strings.Repeat("reflink", 1024)
+	writeTestFile(t, filepath.Join(src, "a.txt"), content)
+	mkdirTest(t, dst)
+
+	report := runCopyer(t, WildcardJob(Source(src), Target(dst)), WithHash(true), WithReflink(ReflinkAuto))
+	if len(report.Errors) > 0 {
+		t.Fatalf("unexpected errors: %v", report.Errors[0])
+	}
+
+	job := findReportJob(report, "src/a.txt")
+	want, err := HashFile(filepath.Join(src, "a.txt"), HashSHA256)
+	if err != nil {
+		t.Fatalf("hash source: %v", err)
+	}
+	if job == nil || len(job.SuccessTargets) != 1 || job.SHA256 != want[HashSHA256] {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+
+	got, err := os.ReadFile(filepath.Join(dst, "src", "a.txt"))
+	if err != nil {
+		t.Fatalf("read target: %v", err)
+	}
+	if string(got) != content {
+		t.Fatalf("target content mismatch")
+	}
+}
+
+func TestParseReflinkMode(t *testing.T) {
+	for name, want := range map[string]ReflinkMode{"never": ReflinkNever, "auto": ReflinkAuto, "always": ReflinkAlways} {
+		mode, err := ParseReflinkMode(name)
+		if err != nil || mode != want {
+			t.Fatalf("parse %s: got %v, %v", name, mode, err)
+		}
+	}
+	if _, err := ParseReflinkMode("sometimes"); err == nil {
+		t.Fatalf("expect parse error, got %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package acp
 
 import (
 	"fmt"
+	"io"
 	"sync"
 	"unsafe"
 
@@ -15,6 +16,8 @@ func NewReportGetter() (EventHandler, ReportGetter) {
 	var lock sync.Mutex
 	jobs := make(map[string]*Job, 8)
 	errors := make([]*Error, 0)
+	deletes := make([]*Delete, 0)
+	devices := make([]*PlanDevice, 0)
 
 	handler := func(ev Event) {
 		switch e := ev.(type) {
@@ -29,6 +32,16 @@ func NewReportGetter() (EventHandler, ReportGetter) {
 			defer lock.Unlock()
 
 			errors = append(errors, e.Error)
+		case *EventDelete:
+			lock.Lock()
+			defer lock.Unlock()
+
+			deletes = append(deletes, e.Delete)
+		case *EventPlanDevice:
+			lock.Lock()
+			defer lock.Unlock()
+
+			devices = append(devices, e.Device)
 		}
 	}
 	getter := func() *Report {
@@ -43,17 +56,28 @@ func NewReportGetter() (EventHandler, ReportGetter) {
 		errorsCopyed := make([]*Error, 0, len(jobs))
 		errorsCopyed = append(errorsCopyed, errors...)
 
+		deletesCopyed := make([]*Delete, 0, len(deletes))
+		deletesCopyed = append(deletesCopyed, deletes...)
+
+		devicesCopyed := make([]*PlanDevice, 0, len(devices))
+		devicesCopyed = append(devicesCopyed, devices...)
+
 		return &Report{
-			Jobs:   jobsCopyed,
-			Errors: errorsCopyed,
+			Jobs:        jobsCopyed,
+			Errors:      errorsCopyed,
+			Deletes:     deletesCopyed,
+			PlanDevices: devicesCopyed,
 		}
 	}
 	return handler, getter
 }
 
 type Report struct {
-	Jobs   []*Job   `json:"files,omitempty"`
-	Errors []*Error `json:"errors,omitempty"`
+	Jobs    []*Job    `json:"files,omitempty"`
+	Errors  []*Error  `json:"errors,omitempty"`
+	Deletes []*Delete `json:"deletes,omitempty"`
+
+	PlanDevices []*PlanDevice `json:"plan_devices,omitempty"`
 }
 
 func (r *Report) ToJSONString(indent bool) string {
@@ -66,6 +90,15 @@ func (r *Report) ToJSONString(indent bool) string {
 	return string(buf)
 }
 
+// ReadReport decode a json report, which is generated by `Report.ToJSONString`.
+func ReadReport(r io.Reader) (*Report, error) {
+	report := new(Report)
+	if err := reportJSON.NewDecoder(r).Decode(report); err != nil {
+		return nil, fmt.Errorf("decode report fail, %w", err)
+	}
+	return report, nil
+}
+
 var (
 	reportJSON jsoniter.API
 )
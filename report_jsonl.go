@@ -0,0 +1,158 @@
+package acp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	defaultReportSyncInterval = 5 * time.Second
+)
+
+// reportLine is one line of JSON Lines report, only one of fields is set.
+type reportLine struct {
+	Job        *Job        `json:"job,omitempty"`
+	Error      *Error      `json:"error,omitempty"`
+	Delete     *Delete     `json:"delete,omitempty"`
+	PlanDevice *PlanDevice `json:"plan_device,omitempty"`
+}
+
+type syncer interface {
+	Sync() error
+}
+
+// NewJSONLReportWriter writes each finished job, error, deletion and planned device as a JSON line
+// into w, so the report is not held in memory, and is kept even if the copy is killed.
+// If w can be synced (such like `*os.File`), it is synced every syncInterval, and when copy is finished.
+// The returned function gives the first write error.
+func NewJSONLReportWriter(w io.Writer, syncInterval time.Duration) (EventHandler, func() error) {
+	if syncInterval <= 0 {
+		syncInterval = defaultReportSyncInterval
+	}
+
+	var lock sync.Mutex
+	var writeErr error
+	buf := bufio.NewWriter(w)
+	lastSync := time.Now()
+
+	flush := func(sync bool) {
+		if err := buf.Flush(); err != nil {
+			writeErr = fmt.Errorf("flush report fail, %w", err)
+			return
+		}
+		if s, ok := w.(syncer); ok && sync {
+			if err := s.Sync(); err != nil {
+				writeErr = fmt.Errorf("sync report fail, %w", err)
+				return
+			}
+		}
+		lastSync = time.Now()
+	}
+	write := func(line *reportLine) {
+		b, err := reportJSON.Marshal(line)
+		if err != nil {
+			writeErr = fmt.Errorf("encode report line fail, %w", err)
+			return
+		}
+		if _, err := buf.Write(append(b, '\n')); err != nil {
+			writeErr = fmt.Errorf("write report fail, %w", err)
+			return
+		}
+		if time.Since(lastSync) >= syncInterval {
+			flush(true)
+		}
+	}
+
+	handler := func(ev Event) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if writeErr != nil {
+			return
+		}
+
+		switch e := ev.(type) {
+		case *EventUpdateJob:
+			if !isFinalStatus(e.Job.Status) {
+				return
+			}
+			write(&reportLine{Job: e.Job})
+		case *EventReportError:
+			write(&reportLine{Error: e.Error})
+		case *EventDelete:
+			write(&reportLine{Delete: e.Delete})
+		case *EventPlanDevice:
+			write(&reportLine{PlanDevice: e.Device})
+		case *EventFinished:
+			flush(true)
+		}
+	}
+	getErr := func() error {
+		lock.Lock()
+		defer lock.Unlock()
+		return writeErr
+	}
+	return handler, getErr
+}
+
+func isFinalStatus(status string) bool {
+	switch status {
+	case JobStatusFinished, JobStatusSkipped, JobStatusPlanned:
+		return true
+	default:
+		return false
+	}
+}
+
+// ReadJSONLReport folds a JSON Lines report, which is written by `NewJSONLReportWriter`, into a `Report`.
+// If a job is written more than once, the last one is kept. A broken last line, which can be left
+// by a killed copy, is ignored.
+func ReadJSONLReport(r io.Reader) (*Report, error) {
+	report := new(Report)
+	jobs := make(map[string]int, 64)
+
+	reader := bufio.NewReader(r)
+	for lineNum := 1; ; lineNum++ {
+		buf, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("read report fail, %w", err)
+		}
+		eof := err != nil
+
+		buf = bytes.TrimSpace(buf)
+		if len(buf) > 0 {
+			line := new(reportLine)
+			if err := reportJSON.Unmarshal(buf, line); err != nil {
+				if eof {
+					break
+				}
+				return nil, fmt.Errorf("decode report line fail, line= %d, %w", lineNum, err)
+			}
+
+			switch {
+			case line.Job != nil:
+				if idx, has := jobs[line.Job.FullPath]; has {
+					report.Jobs[idx] = line.Job
+					break
+				}
+				jobs[line.Job.FullPath] = len(report.Jobs)
+				report.Jobs = append(report.Jobs, line.Job)
+			case line.Error != nil:
+				report.Errors = append(report.Errors, line.Error)
+			case line.Delete != nil:
+				report.Deletes = append(report.Deletes, line.Delete)
+			case line.PlanDevice != nil:
+				report.PlanDevices = append(report.PlanDevices, line.PlanDevice)
+			}
+		}
+		if eof {
+			break
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,57 @@
+package acp
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJSONLReport(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "src"), filepath.Join(root, "dst")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "aaaa")
+	writeTestFile(t, filepath.Join(src, "b.txt"), "bbbb")
+	writeTestFile(t, filepath.Join(dst, "src", "b.txt"), "old")
+
+	buf := new(bytes.Buffer)
+	handler, getErr := NewJSONLReportWriter(buf, 0)
+	runCopyer(t, WildcardJob(Source(src), Target(dst)), WithHash(true), WithEventHandler(handler))
+	if err := getErr(); err != nil {
+		t.Fatalf("write report: %v", err)
+	}
+
+	// a killed copy may leave a broken last line
+	buf.WriteString(`{"job":{"full_path":`)
+
+	report, err := ReadJSONLReport(buf)
+	if err != nil {
+		t.Fatalf("read report: %v", err)
+	}
+	if len(report.Jobs) != 2 {
+		t.Fatalf("unexpected jobs: %s", report.ToJSONString(false))
+	}
+
+	a := findReportJob(report, "src/a.txt")
+	if a == nil || a.Status != JobStatusFinished || len(a.SuccessTargets) != 1 || a.SHA256 == "" {
+		t.Fatalf("unexpected job: %+v", a)
+	}
+	b := findReportJob(report, "src/b.txt")
+	target := filepath.Join(dst, "src", "b.txt")
+	if b == nil || b.FailTargets[target] == nil || !strings.Contains(b.FailTargets[target].Error(), "exist") {
+		t.Fatalf("unexpected job: %+v", b)
+	}
+
+	// resume from jsonl report, finished job is skipped
+	if err := os.Remove(target); err != nil {
+		t.Fatalf("remove target: %v", err)
+	}
+	resumed := runCopyer(t, WildcardJob(Source(src), Target(dst)), ResumeFromReport(report))
+	if job := findReportJob(resumed, "src/a.txt"); job == nil || !job.WriteTime.IsZero() {
+		t.Fatalf("finished job is copied again: %+v", job)
+	}
+	if job := findReportJob(resumed, "src/b.txt"); job == nil || len(job.SuccessTargets) != 1 {
+		t.Fatalf("failed job is not copied: %+v", job)
+	}
+}
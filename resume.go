@@ -0,0 +1,94 @@
+package acp
+
+import (
+	"encoding/hex"
+	"os"
+	"path"
+
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+// ResumeFromReport continue an interrupted copy with the report of previous run.
+// Targets which are already written successfully, and still have the same size
+// and mtime as the source, will be skipped. Only pending and failed targets are copied.
+func ResumeFromReport(report *Report) Option {
+	return func(o *option) *option {
+		if report == nil {
+			return o
+		}
+
+		if o.resumeJobs == nil {
+			o.resumeJobs = make(map[string]*Job, len(report.Jobs))
+		}
+		for _, job := range report.Jobs {
+			if job == nil || len(job.SuccessTargets) == 0 {
+				continue
+			}
+			o.resumeJobs[job.FullPath] = job
+		}
+		return o
+	}
+}
+
+// resume moves the targets finished by previous run from `targets` to `successTargets`.
+func (c *Copyer) resume(job *baseJob) {
+	if len(c.resumeJobs) == 0 {
+		return
+	}
+
+	prev, has := c.resumeJobs[path.Join(job.src.base, job.src.path)]
+	if !has {
+		return
+	}
+	if prev.Size != job.stat.size || !prev.ModTime.Equal(job.stat.modTime) {
+		return
+	}
+
+	c.resumeSpan(job, prev)
+	finished := mapset.NewThreadUnsafeSet(prev.SuccessTargets...)
+	targets := make([]string, 0, len(job.targets))
+	for _, target := range job.targets {
+		if finished.Contains(target) && checkTargetFinished(target, job.stat) {
+			job.successTargets = append(job.successTargets, target)
+			continue
+		}
+
+		targets = append(targets, target)
+	}
+	job.targets = targets
+
+	if len(targets) > 0 {
+		return
+	}
+
+	hashes := make(map[string]string, len(prev.Hashes)+1)
+	for name, h := range prev.Hashes {
+		hashes[name] = h
+	}
+	if prev.SHA256 != "" {
+		hashes[HashSHA256] = prev.SHA256
+	}
+	for name, h := range hashes {
+		buf, err := hex.DecodeString(h)
+		if err != nil {
+			continue
+		}
+
+		if job.hashes == nil {
+			job.hashes = make(map[string][]byte, len(hashes))
+		}
+		job.hashes[name] = buf
+	}
+}
+
+func checkTargetFinished(target string, stat *stat) bool {
+	fi, err := os.Stat(target)
+	if err != nil {
+		return false
+	}
+	if !fi.Mode().IsRegular() {
+		return false
+	}
+
+	return fi.Size() == stat.size && fi.ModTime().Equal(stat.modTime)
+}
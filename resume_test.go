@@ -0,0 +1,56 @@
+package acp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResumeFromReport(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "src"), filepath.Join(root, "dst")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "aaaa")
+	writeTestFile(t, filepath.Join(src, "b.txt"), "bbbb")
+	mkdirTest(t, dst)
+
+	first := runCopyer(t, WildcardJob(Source(src), Target(dst)), WithHash(true))
+	for _, job := range first.Jobs {
+		if job.Status != JobStatusFinished || len(job.SuccessTargets) != 1 {
+			t.Fatalf("unexpected first run job: %+v", job)
+		}
+	}
+
+	// pretend `b.txt` was never finished, and change `a.txt` without touching size and mtime,
+	// resume should leave `a.txt` alone and copy `b.txt` again.
+	for _, job := range first.Jobs {
+		if job.Path == "src/b.txt" {
+			job.SuccessTargets = nil
+		}
+	}
+
+	targetA, targetB := filepath.Join(dst, "src", "a.txt"), filepath.Join(dst, "src", "b.txt")
+	fi, err := os.Stat(targetA)
+	if err != nil {
+		t.Fatalf("stat target: %v", err)
+	}
+	writeTestFile(t, targetA, "AAAA")
+	if err := os.Chtimes(targetA, fi.ModTime(), fi.ModTime()); err != nil {
+		t.Fatalf("chtimes target: %v", err)
+	}
+	writeTestFile(t, targetB, "BB")
+
+	second := runCopyer(t, WildcardJob(Source(src), Target(dst)), WithHash(true), Overwrite(true), ResumeFromReport(first))
+	if len(second.Jobs) != 2 {
+		t.Fatalf("second run jobs = %d", len(second.Jobs))
+	}
+	if job := findReportJob(second, "src/a.txt"); job == nil || job.Status != JobStatusFinished || job.SHA256 == "" {
+		t.Fatalf("resumed job = %+v", job)
+	}
+
+	if buf, _ := os.ReadFile(targetA); string(buf) != "AAAA" {
+		t.Fatalf("finished target is rewritten, content= %q", buf)
+	}
+	if buf, _ := os.ReadFile(targetB); string(buf) != "bbbb" {
+		t.Fatalf("unfinished target is not copied, content= %q", buf)
+	}
+}
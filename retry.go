@@ -0,0 +1,218 @@
+package acp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	mapset "github.com/deckarep/golang-set/v2"
+	"github.com/samuelncui/acp/mmap"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrTransient = fmt.Errorf("acp: transient error")
+)
+
+const (
+	defaultRetryInitialBackoff = time.Second
+	defaultRetryMaxBackoff     = time.Minute
+	defaultRetryMultiplier     = 2
+)
+
+// RetryPolicy controls retries of jobs failed by transient errors, such like
+// EAGAIN, ETIMEDOUT and ESTALE from network mounts or flaky USB enclosures.
+type RetryPolicy struct {
+	// MaxAttempts is the max tries of a job, including the first one.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry, default is 1s.
+	InitialBackoff time.Duration
+	// MaxBackoff is the max wait before a retry, default is 1min.
+	MaxBackoff time.Duration
+	// Multiplier grows the backoff after each retry, default is 2.
+	Multiplier float64
+	// Retryable reports whether a failed job should be retried by the error,
+	// default is IsTransient.
+	Retryable func(err error) bool
+}
+
+// WithRetry retries opening sources and writing targets which are failed by transient errors.
+// Failed targets are written again by re-reading the source, so sources of tar stream
+// and linear device are not retried after opened.
+func WithRetry(policy RetryPolicy) Option {
+	return func(o *option) *option {
+		o.retry = &policy
+		return o
+	}
+}
+
+// IsTransient reports whether err is mapped to ErrTransient, which may succeed on retry.
+func IsTransient(err error) bool {
+	return errors.Is(err, ErrTransient)
+}
+
+func (p *RetryPolicy) check() {
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = defaultRetryInitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = defaultRetryMaxBackoff
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = defaultRetryMultiplier
+	}
+	if p.Retryable == nil {
+		p.Retryable = IsTransient
+	}
+}
+
+// backoff returns the wait before retry after the attempt, attempts start from 1.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	d := float64(p.InitialBackoff)
+	for idx := 1; idx < attempt && d < float64(p.MaxBackoff); idx++ {
+		d *= p.Multiplier
+	}
+	if d > float64(p.MaxBackoff) {
+		return p.MaxBackoff
+	}
+	return time.Duration(d)
+}
+
+// shouldRetry reports whether the job failed by err can be tried again.
+func (c *Copyer) shouldRetry(job *baseJob, err error) bool {
+	if c.retry == nil || !c.retry.Retryable(err) || job.getAttempts() >= c.retry.MaxAttempts {
+		return false
+	}
+	return !c.isStopping()
+}
+
+// waitRetry waits the backoff of the job, returns false if copyer is stopped.
+func (c *Copyer) waitRetry(ctx context.Context, job *baseJob, err error) bool {
+	attempts := job.getAttempts()
+	backoff := c.retry.backoff(attempts)
+	c.logf(logrus.WarnLevel, "retry job after %s, path= '%s', attempts= %d, %s", backoff, job.path, attempts, err)
+
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return !c.isStopping()
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// openSource opens the source file of job, retries if open fails by transient error.
+// Each open is counted as an attempt of job. Zero-size files return a nil reader.
+func (c *Copyer) openSource(ctx context.Context, job *baseJob) (io.ReadCloser, int64, error) {
+	for {
+		job.addAttempt()
+		reader, size, err := c.openFile(job.path)
+		if err == nil {
+			return reader, size, nil
+		}
+
+		err = mappingError(err)
+		if !c.shouldRetry(job, err) {
+			return nil, 0, err
+		}
+		if !c.waitRetry(ctx, job, err) {
+			return nil, 0, err
+		}
+	}
+}
+
+func (c *Copyer) openFile(path string) (io.ReadCloser, int64, error) {
+	if c.fromDevice.linear {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, 0, fmt.Errorf("open src file fail, %w", err)
+		}
+
+		fileInfo, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, 0, fmt.Errorf("get src file stat fail, %w", err)
+		}
+		if fileInfo.Size() == 0 {
+			file.Close()
+			return nil, 0, nil
+		}
+
+		return file, fileInfo.Size(), nil
+	}
+
+	readerAt, err := mmap.Open(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("open src file by mmap fail, %w", err)
+	}
+	if readerAt.Len() == 0 {
+		readerAt.Close()
+		return nil, 0, nil
+	}
+
+	return mmap.NewReader(readerAt), int64(readerAt.Len()), nil
+}
+
+// rewritable reports whether the source of job can be read again.
+func (c *Copyer) rewritable(job *writeJob) bool {
+	return job.stream == nil && !c.fromDevice.linear && job.hasData()
+}
+
+// retryTargets returns failed targets of job which can be written again.
+func (c *Copyer) retryTargets(job *writeJob) []string {
+	if c.retry == nil || !c.rewritable(job) {
+		return nil
+	}
+
+	job.lock.Lock()
+	failed := make(map[string]error, len(job.failedTargets))
+	for target, err := range job.failedTargets {
+		failed[target] = err
+	}
+	job.lock.Unlock()
+
+	targets := make([]string, 0, len(failed))
+	for target, err := range failed {
+		if c.shouldRetry(job.baseJob, err) {
+			targets = append(targets, target)
+		}
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// retryJob writes the job again into failed targets after new media is mounted, or after backoff of
+// transient errors, returns false if the job is not retried. The write of job is started at since of media seq.
+// Archive member is not written again, and progress is not counted again.
+func (c *Copyer) retryJob(ctx context.Context, job *writeJob, since int, ch chan<- *baseJob, workers *deviceWorkers, finishing *sync.WaitGroup, noSpaceDevices mapset.Set[string]) bool {
+	targets := c.mediaTargets(ctx, job, since, noSpaceDevices)
+	if len(targets) == 0 {
+		targets = c.retryTargets(job)
+		if len(targets) == 0 {
+			return false
+		}
+		if !c.waitRetry(ctx, job.baseJob, job.getFailed(targets[0])) {
+			return false
+		}
+	}
+
+	reader, size, err := c.openSource(ctx, job.baseJob)
+	if err != nil {
+		c.reportError(job.path, "", err)
+		return false
+	}
+
+	wj := newWriteJob(job.baseJob, reader, size, false)
+	wj.extents = c.sparseExtents(job.path, job.stat)
+	wj.retryTargets = targets
+	job.clearFailed(targets)
+
+	c.write(ctx, wj, ch, new(counter), workers, finishing, noSpaceDevices)
+	return true
+}
@@ -0,0 +1,140 @@
+package acp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := &RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	p.check()
+
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second} {
+		if got := p.backoff(attempt); got != want {
+			t.Fatalf("unexpected backoff of attempt %d, got= %s want= %s", attempt, got, want)
+		}
+	}
+
+	for _, errno := range []syscall.Errno{syscall.EAGAIN, syscall.ETIMEDOUT, syscall.ESTALE} {
+		if err := mappingError(fmt.Errorf("write fail, %w", errno)); !IsTransient(err) {
+			t.Fatalf("%s is not transient", errno)
+		}
+	}
+	if IsTransient(mappingError(syscall.ENOSPC)) {
+		t.Fatalf("ENOSPC should not be transient")
+	}
+}
+
+func TestRetryTarget(t *testing.T) {
+	root := t.TempDir()
+	src, dst1, dst2 := filepath.Join(root, "src"), filepath.Join(root, "dst1"), filepath.Join(root, "dst2")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "aaaa")
+	// dst2/src is a file, so target dir cannot be created until it is removed
+	writeTestFile(t, filepath.Join(dst2, "src"), "blocker")
+	mkdirTest(t, dst1)
+
+	var once sync.Once
+	report := runCopyer(t, WildcardJob(Source(src), Target(dst1, dst2)), WithHash(true), WithRetry(RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 10 * time.Millisecond,
+		Retryable: func(err error) bool {
+			once.Do(func() { os.Remove(filepath.Join(dst2, "src")) })
+			return true
+		},
+	}))
+
+	job := findReportJob(report, "src/a.txt")
+	if job == nil || len(job.SuccessTargets) != 2 || len(job.FailTargets) != 0 || job.Attempts != 2 || job.SHA256 == "" {
+		t.Fatalf("unexpected retried job: %+v", job)
+	}
+	for _, dst := range []string{dst1, dst2} {
+		if got, err := os.ReadFile(filepath.Join(dst, "src", "a.txt")); err != nil || string(got) != "aaaa" {
+			t.Fatalf("unexpected target in %s: %q, %v", dst, got, err)
+		}
+	}
+}
+
+// removeAfterIndexed runs the copyer, and removes the source after it is indexed.
+func removeAfterIndexed(t *testing.T, src string, opts ...Option) *Report {
+	t.Helper()
+
+	handler, getter := NewReportGetter()
+	onIndexed, indexed := indexedHandler()
+	c, err := New(context.Background(), append(opts, WithEventHandler(handler), WithEventHandler(onIndexed))...)
+	if err != nil {
+		t.Fatalf("new copyer: %v", err)
+	}
+	c.Pause()
+	waitIndexed(t, indexed)
+	os.Remove(src)
+	c.Resume()
+	c.Wait()
+
+	return getter()
+}
+
+func TestOpenSourceFail(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "src"), filepath.Join(root, "dst")
+	mkdirTest(t, dst)
+	writeTestFile(t, filepath.Join(src, "a.txt"), "aaaa")
+
+	// targets of missing source are failed, instead of written as empty files
+	job := findReportJob(removeAfterIndexed(t, filepath.Join(src, "a.txt"), WildcardJob(Source(src), Target(dst))), "src/a.txt")
+	if job == nil || job.Status != JobStatusFinished || len(job.SuccessTargets) != 0 || len(job.FailTargets) != 1 {
+		t.Fatalf("unexpected failed job: %+v", job)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "src", "a.txt")); !os.IsNotExist(err) {
+		t.Fatalf("target of missing source is created, %v", err)
+	}
+}
+
+func TestRetryOpenSource(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "src"), filepath.Join(root, "dst")
+	mkdirTest(t, dst)
+	writeTestFile(t, filepath.Join(src, "a.txt"), "aaaa")
+
+	// source comes back before retry
+	report := removeAfterIndexed(t, filepath.Join(src, "a.txt"), WildcardJob(Source(src), Target(dst)), WithRetry(RetryPolicy{
+		MaxAttempts:    2,
+		InitialBackoff: 10 * time.Millisecond,
+		Retryable: func(err error) bool {
+			writeTestFile(t, filepath.Join(src, "a.txt"), "aaaa")
+			return true
+		},
+	}))
+
+	job := findReportJob(report, "src/a.txt")
+	if job == nil || len(job.SuccessTargets) != 1 || job.Attempts != 2 {
+		t.Fatalf("unexpected retried job: %+v", job)
+	}
+}
+
+func TestRetryOpenSourceMaxAttempts(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "src"), filepath.Join(root, "dst")
+	mkdirTest(t, dst)
+	writeTestFile(t, filepath.Join(src, "a.txt"), "aaaa")
+
+	report := removeAfterIndexed(t, filepath.Join(src, "a.txt"), WildcardJob(Source(src), Target(dst)), WithRetry(RetryPolicy{
+		MaxAttempts:    1,
+		InitialBackoff: 10 * time.Millisecond,
+		Retryable: func(err error) bool {
+			writeTestFile(t, filepath.Join(src, "a.txt"), "aaaa")
+			return true
+		},
+	}))
+
+	// the first open is an attempt, so it is not retried
+	job := findReportJob(report, "src/a.txt")
+	if job == nil || len(job.SuccessTargets) != 0 || len(job.FailTargets) != 1 || job.Attempts != 1 {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+}
@@ -0,0 +1,176 @@
+package acp
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	mapset "github.com/deckarep/golang-set/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// spanVolumes is the ordered target roots of a wildcard job, each file is written into
+// only one of them. Volumes are filled one by one, a full volume is never used again.
+type spanVolumes struct {
+	lock    sync.Mutex
+	volumes []string
+	size    int64 // max bytes written into each volume, zero means free space of device
+	current int
+	used    int64 // bytes written into the current volume
+}
+
+// SpanTarget spreads files over volumes in order, such like a stack of removable disks.
+// Files are written into the first volume until it has no space, then the rest go to
+// the next one. The volume of each file is recorded as `Job.Volume` in report, and
+// manifests are written into each volume by `Report.WriteManifests`.
+func SpanTarget(volumes ...string) WildcardJobOption {
+	return func(j *wildcardJob) *wildcardJob {
+		if j.span == nil {
+			j.span = new(spanVolumes)
+		}
+		j.span.volumes = append(j.span.volumes, volumes...)
+		return j
+	}
+}
+
+// SpanVolumeSize limits bytes written into each volume of SpanTarget, such like the capacity
+// of a disc. Free space of device is always checked.
+func SpanVolumeSize(size int64) WildcardJobOption {
+	return func(j *wildcardJob) *wildcardJob {
+		if j.span == nil {
+			j.span = new(spanVolumes)
+		}
+		j.span.size = size
+		return j
+	}
+}
+
+func (s *spanVolumes) check() error {
+	volumes := make([]string, 0, len(s.volumes))
+	for _, v := range s.volumes {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if v[len(v)-1] != '/' {
+			v = v + "/"
+		}
+
+		stat, err := os.Stat(v)
+		if err != nil {
+			return fmt.Errorf("check span volume '%s', %w", v, err)
+		}
+		if !stat.IsDir() {
+			return fmt.Errorf("span volume is not a dir, '%s'", v)
+		}
+		volumes = append(volumes, v)
+	}
+	if len(volumes) == 0 {
+		return fmt.Errorf("span volume not found")
+	}
+
+	s.volumes = volumes
+	return nil
+}
+
+// targets returns paths of src in all volumes, used by dirs, which may be created in any volume.
+func (s *spanVolumes) targets(src *source) []string {
+	if s == nil {
+		return nil
+	}
+
+	targets := make([]string, 0, len(s.volumes))
+	for _, v := range s.volumes {
+		targets = append(targets, src.dst(v))
+	}
+	return targets
+}
+
+// spanTarget chooses the volume of job, and appends the target in it to job targets.
+// Returns false if all volumes are full.
+func (c *Copyer) spanTarget(job *writeJob, noSpaceDevices mapset.Set[string]) bool {
+	s := job.span
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var need int64
+	if job.hasData() {
+		need = physicalSize(job.size, job.extents)
+	}
+
+	for ; s.current < len(s.volumes); s.current, s.used = s.current+1, 0 {
+		volume := s.volumes[s.current]
+		if s.size > 0 && s.used+need > s.size {
+			if s.used == 0 {
+				// file larger than a volume never fits
+				break
+			}
+			c.logf(logrus.InfoLevel, "span volume is full, continue on next volume, volume= '%s', used= %d", volume, s.used)
+			continue
+		}
+
+		dev := c.getDevice(volume)
+		if noSpaceDevices.Contains(dev) {
+			continue
+		}
+		if err := c.getDiskUsageCache(dev).check(need); err != nil {
+			if !errors.Is(err, ErrTargetNoSpace) {
+				c.reportError(job.path, volume, fmt.Errorf("check span volume disk usage have error, %w", err))
+			}
+			c.logf(logrus.InfoLevel, "span volume has no space, continue on next volume, volume= '%s', %s", volume, err)
+			continue
+		}
+
+		s.used += need
+		job.setVolume(volume)
+		return true
+	}
+
+	job.fail(job.src.dst(s.volumes[len(s.volumes)-1]), fmt.Errorf("all span volumes are full, %w", ErrTargetNoSpace))
+	return false
+}
+
+// resumeSpan finds the target written by previous run in the volume recorded in report.
+func (c *Copyer) resumeSpan(job *baseJob, prev *Job) {
+	if job.span == nil || prev.Volume == "" {
+		return
+	}
+
+	target := job.src.dst(prev.Volume)
+	for _, success := range prev.SuccessTargets {
+		if success == target && checkTargetFinished(target, job.stat) {
+			job.volume = prev.Volume
+			job.successTargets = append(job.successTargets, target)
+			return
+		}
+	}
+}
+
+// linkSpan makes the hard link of job in the same volume as the linked job.
+func (j *baseJob) linkSpan() {
+	if j.span == nil || j.linkTo == nil {
+		return
+	}
+
+	volume := j.linkTo.getVolume()
+	if volume == "" {
+		return
+	}
+	j.setVolume(volume)
+}
+
+func (j *baseJob) setVolume(volume string) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	j.volume = volume
+	j.targets = append(j.targets, j.src.dst(volume))
+}
+
+func (j *baseJob) getVolume() string {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.volume
+}
@@ -0,0 +1,70 @@
+package acp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSpanTarget(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "src")
+	volumes := []string{filepath.Join(root, "vol1"), filepath.Join(root, "vol2"), filepath.Join(root, "vol3")}
+	mkdirTest(t, volumes...)
+	for idx := 0; idx < 7; idx++ {
+		writeTestFile(t, filepath.Join(src, "sub", fmt.Sprintf("%d.txt", idx)), strings.Repeat(fmt.Sprint(idx), 100))
+	}
+
+	// each volume holds two files
+	report := runCopyer(t, WildcardJob(Source(src), SpanTarget(volumes...), SpanVolumeSize(250)), WithHash(true))
+
+	counts := make(map[string]int)
+	var failed int
+	for _, job := range report.Jobs {
+		if job.Mode.IsDir() {
+			continue
+		}
+		if len(job.FailTargets) > 0 {
+			failed++
+			continue
+		}
+
+		if job.Volume == "" || len(job.SuccessTargets) != 1 || job.SuccessTargets[0] != filepath.Join(job.Volume, job.Path) {
+			t.Fatalf("unexpected span job: %+v", job)
+		}
+		counts[job.Volume]++
+	}
+	if failed != 1 || len(counts) != 3 {
+		t.Fatalf("unexpected spanned volumes, failed= %d, counts= %v", failed, counts)
+	}
+	for volume, n := range counts {
+		if n != 2 {
+			t.Fatalf("unexpected files in volume %s: %d", volume, n)
+		}
+	}
+
+	written, err := report.WriteManifests(HashSHA256, ManifestGNU)
+	if err != nil || len(written) != 3 {
+		t.Fatalf("unexpected manifests: %v, %v", written, err)
+	}
+	for _, p := range written {
+		buf, err := os.ReadFile(p)
+		if err != nil || strings.Count(string(buf), "\n") != 2 {
+			t.Fatalf("unexpected manifest %s: %q, %v", p, buf, err)
+		}
+	}
+
+	// finished files are found in their volumes, nothing is written again
+	resumed := runCopyer(t, WildcardJob(Source(src), SpanTarget(volumes...), SpanVolumeSize(250)), ResumeFromReport(report))
+	for _, job := range resumed.Jobs {
+		prev := findReportJob(report, job.Path)
+		if job.Mode.IsDir() || len(prev.FailTargets) > 0 {
+			continue
+		}
+		if job.Volume != prev.Volume || !job.WriteTime.IsZero() {
+			t.Fatalf("unexpected resumed job: %+v", job)
+		}
+	}
+}
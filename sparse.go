@@ -0,0 +1,93 @@
+package acp
+
+import (
+	"io"
+	"os"
+
+	"github.com/sirupsen/logrus"
+)
+
+// extent is a range of file which contains data, the ranges between extents are holes.
+type extent struct {
+	offset, length int64
+}
+
+// chunk is a piece of file sent from reader to writers, a chunk is either data or a hole.
+type chunk struct {
+	data []byte
+	hole int64
+}
+
+func (c *chunk) len() int64 {
+	if c.hole > 0 {
+		return c.hole
+	}
+	return int64(len(c.data))
+}
+
+var zeroBuf = make([]byte, batchSize)
+
+// WithSparse detect holes of sparse source files, holes are skipped when reading and
+// preserved on targets. Enabled by default.
+func WithSparse(b bool) Option {
+	return func(o *option) *option {
+		o.sparse = b
+		return o
+	}
+}
+
+// sparseExtents returns data extents of a sparse file, returns nil if the file is not sparse,
+// then the whole file should be read. A file with only holes returns an empty slice.
+func (c *Copyer) sparseExtents(path string, st *stat) []extent {
+	if !c.sparse || !st.mode.IsRegular() || !maybeSparse(st) {
+		return nil
+	}
+
+	extents, err := detectExtents(path, st.size)
+	if err != nil {
+		c.logf(logrus.DebugLevel, "detect sparse extents fail, path= '%s', %s", path, err)
+		return nil
+	}
+	if len(extents) == 1 && extents[0].offset == 0 && extents[0].length == st.size {
+		return nil
+	}
+	return extents
+}
+
+// writeZero writes n zero bytes, used for holes on linear devices.
+func writeZero(w io.Writer, n int64) error {
+	for n > 0 {
+		buf := zeroBuf
+		if n < int64(len(buf)) {
+			buf = buf[:n]
+		}
+
+		nw, err := w.Write(buf)
+		if err != nil {
+			return err
+		}
+		n -= int64(nw)
+	}
+	return nil
+}
+
+// skipHole leaves a hole of n bytes at offset of file, the file should be truncated to its size before.
+func skipHole(file *os.File, offset, n int64) error {
+	if err := punchHole(file, offset, n); err != nil {
+		return err
+	}
+	_, err := file.Seek(offset+n, io.SeekStart)
+	return err
+}
+
+func physicalSize(size int64, extents []extent) int64 {
+	if extents == nil {
+		return size
+	}
+
+	var n int64
+	for _, e := range extents {
+		n += e.length
+	}
+	return n
+}
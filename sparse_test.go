@@ -0,0 +1,106 @@
+//go:build darwin || linux
+// +build darwin linux
+
+package acp
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// writeSparseFile writes a sparse file with returned data in the fourth batch, skips the test if the file system
+// does not support sparse files.
+func writeSparseFile(t *testing.T, name string, size int64) []byte {
+	t.Helper()
+
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatalf("create sparse file: %v", err)
+	}
+	data := bytes.Repeat([]byte("acp"), 1000)
+	if _, err := f.WriteAt(data, 3*batchSize); err != nil {
+		t.Fatalf("write sparse file: %v", err)
+	}
+	if err := f.Truncate(size); err != nil {
+		t.Fatalf("truncate sparse file: %v", err)
+	}
+	f.Close()
+
+	fi, err := os.Stat(name)
+	if err != nil {
+		t.Fatalf("stat sparse file: %v", err)
+	}
+	if fi.Sys().(*syscall.Stat_t).Blocks*512 >= size {
+		t.Skip("file system does not support sparse files")
+	}
+	return data
+}
+
+func TestCopySparseFile(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "src"), filepath.Join(root, "dst")
+	mkdirTest(t, src, dst)
+
+	const size = 8 * batchSize
+	name := filepath.Join(src, "disk.img")
+	data := writeSparseFile(t, name, size)
+
+	var physical int64
+	report := runCopyer(t, WildcardJob(Source(name), Target(dst)), WithHash(true), WithEventHandler(func(ev Event) {
+		if e, ok := ev.(*EventUpdateProgress); ok && e.Finished {
+			physical = e.PhysicalBytes
+		}
+	}))
+	if len(report.Errors) > 0 {
+		t.Fatalf("unexpected errors: %v", report.Errors[0])
+	}
+
+	want, err := HashFile(name, HashSHA256)
+	if err != nil {
+		t.Fatalf("hash source: %v", err)
+	}
+	job := findReportJob(report, "disk.img")
+	if job == nil || job.SHA256 != want[HashSHA256] {
+		t.Fatalf("unexpected job: %+v, want sha256 %s", job, want[HashSHA256])
+	}
+
+	target := filepath.Join(dst, "disk.img")
+	got, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatalf("read target: %v", err)
+	}
+	expected := make([]byte, size)
+	copy(expected[3*batchSize:], data)
+	if !bytes.Equal(got, expected) {
+		t.Fatalf("target content mismatch")
+	}
+
+	if physical <= 0 || physical >= size {
+		t.Fatalf("holes are read, physical bytes= %d", physical)
+	}
+	tfi, err := os.Stat(target)
+	if err != nil {
+		t.Fatalf("stat target: %v", err)
+	}
+	if blocks := tfi.Sys().(*syscall.Stat_t).Blocks; blocks*512 >= size {
+		t.Fatalf("target is not sparse, blocks= %d", blocks)
+	}
+}
+
+func TestDryRunPlanSparseFile(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "src"), filepath.Join(root, "dst")
+	mkdirTest(t, src, dst)
+
+	const size = 8 * batchSize
+	writeSparseFile(t, filepath.Join(src, "disk.img"), size)
+
+	// holes are not counted in the planned space
+	report := runCopyer(t, WildcardJob(Source(src), Target(dst)), WithDryRun(true))
+	if len(report.PlanDevices) != 1 || report.PlanDevices[0].Need <= 0 || report.PlanDevices[0].Need >= size {
+		t.Fatalf("unexpected plan devices: %s", report.ToJSONString(false))
+	}
+}
@@ -0,0 +1,60 @@
+package acp
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+// writeSpecial creates the entries without data, such like symbolic links, fifos, devices and empty dirs.
+func (c *Copyer) writeSpecial(job *writeJob, noSpaceDevices mapset.Set[string]) {
+	for _, target := range job.targets {
+		dev := c.getDevice(target)
+		if noSpaceDevices.Contains(dev) {
+			job.fail(target, ErrTargetNoSpace)
+			continue
+		}
+
+		if err := mappingError(os.MkdirAll(path.Dir(target), os.ModePerm)); err != nil {
+			if checkErrorAbort(err) {
+				noSpaceDevices.Add(dev)
+			}
+
+			job.fail(target, fmt.Errorf("mkdir dst dir fail, %w", err))
+			continue
+		}
+
+		if err := mappingError(c.createSpecial(target, job.stat)); err != nil {
+			if checkErrorAbort(err) {
+				noSpaceDevices.Add(dev)
+			}
+
+			job.fail(target, fmt.Errorf("create dst file fail, mode= %s, %w", job.stat.mode, err))
+			continue
+		}
+
+		job.success(target)
+	}
+}
+
+func (c *Copyer) createSpecial(target string, stat *stat) error {
+	if stat.mode.IsDir() {
+		return os.MkdirAll(target, os.ModePerm)
+	}
+
+	if _, err := os.Lstat(target); err == nil {
+		if c.createFlag&os.O_EXCL != 0 {
+			return fmt.Errorf("dst file exists, %w", os.ErrExist)
+		}
+		if err := os.Remove(target); err != nil {
+			return fmt.Errorf("remove exists dst file fail, %w", err)
+		}
+	}
+
+	if stat.mode&os.ModeSymlink != 0 {
+		return os.Symlink(stat.link, target)
+	}
+	return mknod(target, stat)
+}
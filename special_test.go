@@ -0,0 +1,155 @@
+//go:build darwin || linux
+// +build darwin linux
+
+package acp
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestCopySpecialFiles(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "src"), filepath.Join(root, "dst")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "aaaa")
+	if err := os.Symlink("a.txt", filepath.Join(src, "link")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	if err := syscall.Mkfifo(filepath.Join(src, "fifo"), 0o600); err != nil {
+		t.Fatalf("mkfifo: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(src, "empty"), 0o750); err != nil {
+		t.Fatalf("mkdir empty: %v", err)
+	}
+	mkdirTest(t, dst)
+
+	report := runCopyer(
+		t, WildcardJob(Source(src), Target(dst)),
+		WithPreserveLinks(true), WithSpecialFiles(true), WithEmptyDirs(true),
+	)
+	for _, job := range report.Jobs {
+		if job.Status != JobStatusFinished || len(job.SuccessTargets) != 1 {
+			t.Fatalf("unexpected job, %+v", job)
+		}
+	}
+	if len(report.Jobs) != 4 {
+		t.Fatalf("jobs = %d", len(report.Jobs))
+	}
+
+	link, err := os.Readlink(filepath.Join(dst, "src", "link"))
+	if err != nil || link != "a.txt" {
+		t.Fatalf("read link, link= %q err= %v", link, err)
+	}
+	if fi, err := os.Lstat(filepath.Join(dst, "src", "fifo")); err != nil || fi.Mode()&os.ModeNamedPipe == 0 {
+		t.Fatalf("stat fifo, fi= %v err= %v", fi, err)
+	}
+	if fi, err := os.Stat(filepath.Join(dst, "src", "empty")); err != nil || !fi.IsDir() || fi.Mode().Perm() != 0o750 {
+		t.Fatalf("stat empty dir, fi= %v err= %v", fi, err)
+	}
+}
+
+func TestDereferenceLinks(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "src"), filepath.Join(root, "dst")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "aaaa")
+	if err := os.Symlink("a.txt", filepath.Join(src, "link")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(src, "empty"), 0o750); err != nil {
+		t.Fatalf("mkdir empty: %v", err)
+	}
+	mkdirTest(t, dst)
+
+	report := runCopyer(t, WildcardJob(Source(src), Target(dst)))
+	if len(report.Jobs) != 2 {
+		t.Fatalf("jobs = %d", len(report.Jobs))
+	}
+	if fi, err := os.Lstat(filepath.Join(dst, "src", "link")); err != nil || !fi.Mode().IsRegular() {
+		t.Fatalf("link is not dereferenced, fi= %v err= %v", fi, err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "src", "empty")); !os.IsNotExist(err) {
+		t.Fatalf("empty dir is copied, err= %v", err)
+	}
+}
+
+func TestCopyHardLinks(t *testing.T) {
+	root := t.TempDir()
+	src, dst1, dst2 := filepath.Join(root, "src"), filepath.Join(root, "dst1"), filepath.Join(root, "dst2")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "aaaa")
+	writeTestFile(t, filepath.Join(src, "c.txt"), "cccc")
+	mkdirTest(t, filepath.Join(src, "sub"))
+	if err := os.Link(filepath.Join(src, "a.txt"), filepath.Join(src, "sub", "b.txt")); err != nil {
+		t.Fatalf("link: %v", err)
+	}
+	mkdirTest(t, dst1, dst2)
+
+	report := runCopyer(t, WildcardJob(Source(src), Target(dst1, dst2)), WithHardLinks(true), WithHash(true))
+	if len(report.Jobs) != 3 {
+		t.Fatalf("jobs = %d", len(report.Jobs))
+	}
+
+	linked := findReportJob(report, "src/sub/b.txt")
+	if linked == nil || linked.HardLinkTo != filepath.Join(src, "a.txt") || len(linked.SuccessTargets) != 2 || linked.SHA256 == "" {
+		t.Fatalf("unexpected linked job, %+v", linked)
+	}
+
+	for _, dst := range []string{dst1, dst2} {
+		a, err := os.Stat(filepath.Join(dst, "src", "a.txt"))
+		if err != nil {
+			t.Fatalf("stat a: %v", err)
+		}
+		b, err := os.Stat(filepath.Join(dst, "src", "sub", "b.txt"))
+		if err != nil {
+			t.Fatalf("stat b: %v", err)
+		}
+		if !os.SameFile(a, b) {
+			t.Fatalf("targets in %s are not linked", dst)
+		}
+	}
+}
+
+func TestTarTargetLinks(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "src")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "aaaa")
+	if err := os.Link(filepath.Join(src, "a.txt"), filepath.Join(src, "b.txt")); err != nil {
+		t.Fatalf("link: %v", err)
+	}
+	if err := os.Symlink("a.txt", filepath.Join(src, "c.txt")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+
+	buf := new(bytes.Buffer)
+	report := runCopyer(t, WildcardJob(Source(src)), WithTarTarget(buf), WithPreserveLinks(true), WithHardLinks(true))
+	if len(report.Errors) > 0 {
+		t.Fatalf("unexpected errors: %v", report.Errors[0])
+	}
+
+	headers := make(map[string]*tar.Header)
+	tr := tar.NewReader(buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read archive: %v", err)
+		}
+		headers[hdr.Name] = hdr
+	}
+
+	if hdr := headers["src/a.txt"]; hdr == nil || hdr.Typeflag != tar.TypeReg || hdr.Size != 4 {
+		t.Fatalf("unexpected header of a.txt: %+v", hdr)
+	}
+	if hdr := headers["src/b.txt"]; hdr == nil || hdr.Typeflag != tar.TypeLink || hdr.Linkname != "src/a.txt" {
+		t.Fatalf("unexpected header of b.txt: %+v", hdr)
+	}
+	if hdr := headers["src/c.txt"]; hdr == nil || hdr.Typeflag != tar.TypeSymlink || hdr.Linkname != "a.txt" {
+		t.Fatalf("unexpected header of c.txt: %+v", hdr)
+	}
+}
@@ -3,6 +3,7 @@ package acp
 import (
 	"fmt"
 	"io/fs"
+	"os"
 	"time"
 )
 
@@ -10,6 +11,7 @@ type stat struct {
 	size    int64       // length in bytes for regular files; system-dependent for others
 	mode    fs.FileMode // file mode bits
 	modTime time.Time   // modification time
+	link    string      // target of symbolic link
 	sys     *sysStat
 }
 
@@ -19,10 +21,19 @@ func newStat(path string, fi fs.FileInfo) (*stat, error) {
 		return nil, fmt.Errorf("read sys stat failed, %w", err)
 	}
 
+	var link string
+	if fi.Mode()&fs.ModeSymlink != 0 {
+		link, err = os.Readlink(path)
+		if err != nil {
+			return nil, fmt.Errorf("read link failed, %w", err)
+		}
+	}
+
 	return &stat{
 		size:    fi.Size(),
 		mode:    fi.Mode(),
 		modTime: fi.ModTime(),
+		link:    link,
 		sys:     sysStat,
 	}, nil
 }
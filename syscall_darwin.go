@@ -11,6 +11,10 @@ import (
 	"golang.org/x/sys/unix"
 )
 
+func cloneFile(dst, src *os.File, size int64) error {
+	return ErrReflinkUnsupported
+}
+
 func truncate(file *os.File, size int64) error {
 	if err := file.Truncate(size); err != nil {
 		return err
@@ -18,6 +22,11 @@ func truncate(file *os.File, size int64) error {
 	return nil
 }
 
+// punchHole do nothing, target is truncated before written, so the range is already a hole.
+func punchHole(file *os.File, offset, length int64) error {
+	return nil
+}
+
 func isNoAttrErr(err error) bool {
 	return errors.Is(err, unix.ENOATTR) || errors.Is(err, unix.ENODATA)
 }
@@ -25,3 +34,16 @@ func isNoAttrErr(err error) bool {
 func checkXattrKey(key string) bool {
 	return !strings.HasPrefix(key, "system.")
 }
+
+func firstPhysicalExtent(path string) (uint64, error) {
+	return 0, errors.New("physical extent is not supported")
+}
+
+func renameNoReplace(old, new string) error {
+	return linkRename(old, new)
+}
+
+// dropPageCache do nothing, page cache of a file cannot be dropped on darwin.
+func dropPageCache(path string) error {
+	return nil
+}
@@ -5,19 +5,60 @@ package acp
 
 import (
 	"errors"
+	"fmt"
+	"math"
 	"os"
 	"syscall"
+	"unsafe"
 
 	"golang.org/x/sys/unix"
 )
 
 func truncate(file *os.File, size int64) error {
+	// fallocate refuses zero length
+	if size == 0 {
+		return file.Truncate(0)
+	}
 	if err := syscall.Fallocate(int(file.Fd()), 0, 0, size); err != nil {
 		return err
 	}
 	return nil
 }
 
+// punchHole deallocates the range of file, file systems without support are ignored.
+func punchHole(file *os.File, offset, length int64) error {
+	err := unix.Fallocate(int(file.Fd()), unix.FALLOC_FL_PUNCH_HOLE|unix.FALLOC_FL_KEEP_SIZE, offset, length)
+	if err != nil && !errors.Is(err, unix.EOPNOTSUPP) {
+		return err
+	}
+	return nil
+}
+
+// cloneFile clones src into dst by FICLONE, and then by copy_file_range, which can also
+// share extents on some file systems.
+func cloneFile(dst, src *os.File, size int64) error {
+	if err := unix.IoctlFileClone(int(dst.Fd()), int(src.Fd())); err == nil {
+		return nil
+	}
+
+	for remain := size; remain > 0; {
+		length := remain
+		if length > 1<<30 {
+			length = 1 << 30
+		}
+
+		n, err := unix.CopyFileRange(int(src.Fd()), nil, int(dst.Fd()), nil, int(length), 0)
+		if err != nil {
+			return fmt.Errorf("%w, copy file range fail, %s", ErrReflinkUnsupported, err)
+		}
+		if n == 0 {
+			return fmt.Errorf("copy file range fail, unexpected end of src file, remain= %d", remain)
+		}
+		remain -= int64(n)
+	}
+	return nil
+}
+
 func isNoAttrErr(err error) bool {
 	return errors.Is(err, unix.ENODATA)
 }
@@ -25,3 +66,72 @@ func isNoAttrErr(err error) bool {
 func checkXattrKey(key string) bool {
 	return true
 }
+
+// fiemap with one extent, from linux/fiemap.h
+type fiemap struct {
+	start         uint64
+	length        uint64
+	flags         uint32
+	mappedExtents uint32
+	extentCount   uint32
+	reserved      uint32
+	extent        fiemapExtent
+}
+
+type fiemapExtent struct {
+	logical  uint64
+	physical uint64
+	length   uint64
+	reserved [2]uint64
+	flags    uint32
+	_        [3]uint32
+}
+
+const (
+	// _IOWR('f', 11, struct fiemap), struct fiemap is 32 bytes without extents
+	fsIocFiemap = 3<<30 | 32<<16 | 'f'<<8 | 11
+	// physical offset of the extent is not known yet, such like delayed allocation
+	fiemapExtentUnknown = 0x2
+)
+
+// firstPhysicalExtent returns the physical offset of the first extent of file by FIEMAP.
+func firstPhysicalExtent(path string) (uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	fm := fiemap{length: math.MaxUint64, extentCount: 1}
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, file.Fd(), fsIocFiemap, uintptr(unsafe.Pointer(&fm))); errno != 0 {
+		return 0, errno
+	}
+	if fm.mappedExtents == 0 || fm.extent.flags&fiemapExtentUnknown != 0 {
+		return 0, errors.New("physical extent is unknown")
+	}
+	return fm.extent.physical, nil
+}
+
+// renameNoReplace renames old to new by renameat2, fails with EEXIST if new exists.
+// Link and unlink is used if the file system does not support it.
+func renameNoReplace(old, new string) error {
+	err := unix.Renameat2(unix.AT_FDCWD, old, unix.AT_FDCWD, new, unix.RENAME_NOREPLACE)
+	if errors.Is(err, unix.EINVAL) || errors.Is(err, unix.ENOSYS) || errors.Is(err, unix.ENOTSUP) {
+		return linkRename(old, new)
+	}
+	return err
+}
+
+// dropPageCache flushes file and drops its pages from page cache, so the next read is from disk.
+func dropPageCache(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	return unix.Fadvise(int(file.Fd()), 0, 0, unix.FADV_DONTNEED)
+}
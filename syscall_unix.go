@@ -4,10 +4,13 @@
 package acp
 
 import (
+	"archive/tar"
 	"errors"
 	"fmt"
 	"io/fs"
 	"os"
+	"reflect"
+	"strings"
 	"syscall"
 
 	"golang.org/x/sys/unix"
@@ -29,6 +32,11 @@ func readSysStat(path string, stat fs.FileInfo) (*sysStat, error) {
 		return nil, fmt.Errorf("stat sys failed, %T", stat.Sys())
 	}
 
+	// xattr syscalls follow symbolic links, so xattrs of links are not copied
+	if stat.Mode()&fs.ModeSymlink != 0 {
+		return &sysStat{Stat_t: sysstat}, nil
+	}
+
 	xattrs, err := readXattrs(path)
 	if err != nil {
 		return nil, fmt.Errorf("read xattrs failed, %w", err)
@@ -38,6 +46,10 @@ func readSysStat(path string, stat fs.FileInfo) (*sysStat, error) {
 }
 
 func writeSysStat(name string, j *stat) error {
+	if j.mode&fs.ModeSymlink != 0 {
+		return writeLinkSysStat(name, j)
+	}
+
 	if err := writeXattrs(name, j.sys.xattrs); err != nil {
 		return fmt.Errorf("write xattr fail, %w", err)
 	}
@@ -55,6 +67,57 @@ func writeSysStat(name string, j *stat) error {
 	return nil
 }
 
+// getFileID returns the identity of a regular file which has more than one hard link.
+func getFileID(j *stat) (fileID, bool) {
+	if j.sys == nil || j.sys.Stat_t == nil || !j.mode.IsRegular() || j.sys.Nlink <= 1 {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(j.sys.Dev), ino: uint64(j.sys.Ino)}, true
+}
+
+// getInode returns device and inode number of file, used to order files.
+func getInode(j *stat) (uint64, uint64, bool) {
+	if j.sys == nil || j.sys.Stat_t == nil {
+		return 0, 0, false
+	}
+	return uint64(j.sys.Dev), uint64(j.sys.Ino), true
+}
+
+func writeLinkSysStat(name string, j *stat) error {
+	if os.Geteuid() == 0 {
+		if err := os.Lchown(name, int(j.sys.Uid), int(j.sys.Gid)); err != nil {
+			return fmt.Errorf("lchown fail, %w", err)
+		}
+	}
+
+	tv := unix.NsecToTimeval(j.modTime.UnixNano())
+	if err := unix.Lutimes(name, []unix.Timeval{tv, tv}); err != nil {
+		return fmt.Errorf("lutimes fail, %w", err)
+	}
+	return nil
+}
+
+// mknod creates fifo and device files, creating device files requires root.
+func mknod(name string, j *stat) error {
+	perm := uint32(j.mode.Perm())
+	switch {
+	case j.mode&fs.ModeNamedPipe != 0:
+		return unix.Mkfifo(name, perm)
+	case j.mode&fs.ModeDevice != 0:
+		if os.Geteuid() != 0 {
+			return fmt.Errorf("create device file requires root")
+		}
+
+		mode := uint32(unix.S_IFBLK)
+		if j.mode&fs.ModeCharDevice != 0 {
+			mode = unix.S_IFCHR
+		}
+		return unix.Mknod(name, mode|perm, int(j.sys.Rdev))
+	default:
+		return fmt.Errorf("unexpected file mode for mknod, mode= %s", j.mode)
+	}
+}
+
 func readXattrs(path string) ([]xattr, error) {
 	size, err := unix.Listxattr(path, nil)
 	if err != nil {
@@ -137,3 +200,97 @@ func writeXattrs(path string, xattrs []xattr) error {
 	}
 	return nil
 }
+
+// maybeSparse reports whether the file has less blocks allocated than its size.
+func maybeSparse(st *stat) bool {
+	if st.sys == nil || st.sys.Stat_t == nil {
+		return false
+	}
+	return int64(st.sys.Blocks)*512 < st.size
+}
+
+// detectExtents finds data extents of file by SEEK_DATA and SEEK_HOLE.
+func detectExtents(path string, size int64) ([]extent, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	fd := int(file.Fd())
+	extents := make([]extent, 0, 4)
+	for offset := int64(0); offset < size; {
+		data, err := unix.Seek(fd, offset, unix.SEEK_DATA)
+		if err != nil {
+			if errors.Is(err, unix.ENXIO) {
+				break
+			}
+			return nil, fmt.Errorf("seek data fail, %w", err)
+		}
+		if data >= size {
+			break
+		}
+
+		hole, err := unix.Seek(fd, data, unix.SEEK_HOLE)
+		if err != nil {
+			return nil, fmt.Errorf("seek hole fail, %w", err)
+		}
+		if hole > size {
+			hole = size
+		}
+
+		extents = append(extents, extent{offset: data, length: hole - data})
+		offset = hole
+	}
+	return extents, nil
+}
+
+// fillArchiveHeader sets owner, device numbers and xattrs of stat into tar header.
+func fillArchiveHeader(hdr *tar.Header, st *stat) {
+	if st.sys == nil || st.sys.Stat_t == nil {
+		return
+	}
+
+	hdr.Uid, hdr.Gid = int(st.sys.Uid), int(st.sys.Gid)
+	if st.mode&fs.ModeDevice != 0 {
+		hdr.Devmajor, hdr.Devminor = int64(unix.Major(uint64(st.sys.Rdev))), int64(unix.Minor(uint64(st.sys.Rdev)))
+	}
+	for _, x := range st.sys.xattrs {
+		if hdr.PAXRecords == nil {
+			hdr.PAXRecords = make(map[string]string, len(st.sys.xattrs))
+		}
+		hdr.PAXRecords["SCHILY.xattr."+x.key] = string(x.value)
+	}
+}
+
+// newTarSysStat builds sys stat from owner, device numbers and xattrs of tar header.
+func newTarSysStat(hdr *tar.Header) *sysStat {
+	st := &syscall.Stat_t{Uid: uint32(hdr.Uid), Gid: uint32(hdr.Gid)}
+
+	// type of rdev is different between platforms
+	rdev := unix.Mkdev(uint32(hdr.Devmajor), uint32(hdr.Devminor))
+	switch v := reflect.ValueOf(&st.Rdev).Elem(); v.Kind() {
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		v.SetInt(int64(rdev))
+	default:
+		v.SetUint(rdev)
+	}
+
+	xattrs := make([]xattr, 0)
+	for key, value := range hdr.PAXRecords {
+		if name := strings.TrimPrefix(key, "SCHILY.xattr."); name != key {
+			xattrs = append(xattrs, xattr{key: name, value: []byte(value)})
+		}
+	}
+	return &sysStat{Stat_t: st, xattrs: xattrs}
+}
+
+// syncDir flushes entries of dir, so renames in it are durable.
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return file.Sync()
+}
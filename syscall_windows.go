@@ -4,6 +4,7 @@
 package acp
 
 import (
+	"archive/tar"
 	"fmt"
 	"io/fs"
 	"os"
@@ -15,6 +16,28 @@ func readSysStat(path string, stat fs.FileInfo) (*sysStat, error) {
 	return nil, nil
 }
 
+func maybeSparse(st *stat) bool {
+	return false
+}
+
+func detectExtents(path string, size int64) ([]extent, error) {
+	return nil, nil
+}
+
+func punchHole(file *os.File, offset, length int64) error {
+	return nil
+}
+
+func cloneFile(dst, src *os.File, size int64) error {
+	return ErrReflinkUnsupported
+}
+
+func fillArchiveHeader(hdr *tar.Header, st *stat) {}
+
+func newTarSysStat(hdr *tar.Header) *sysStat {
+	return nil
+}
+
 func truncate(file *os.File, size int64) error {
 	if err := file.Truncate(size); err != nil {
 		return err
@@ -23,6 +46,10 @@ func truncate(file *os.File, size int64) error {
 }
 
 func writeSysStat(name string, j *stat) error {
+	if j.mode&fs.ModeSymlink != 0 {
+		return nil
+	}
+
 	if err := os.Chmod(name, j.mode); err != nil {
 		return fmt.Errorf("chmod fail, %w", err)
 	}
@@ -31,3 +58,33 @@ func writeSysStat(name string, j *stat) error {
 	}
 	return nil
 }
+
+func mknod(name string, j *stat) error {
+	return fmt.Errorf("create special file is not supported, mode= %s", j.mode)
+}
+
+func getFileID(j *stat) (fileID, bool) {
+	return fileID{}, false
+}
+
+func getInode(j *stat) (uint64, uint64, bool) {
+	return 0, 0, false
+}
+
+func firstPhysicalExtent(path string) (uint64, error) {
+	return 0, fmt.Errorf("physical extent is not supported")
+}
+
+func renameNoReplace(old, new string) error {
+	return linkRename(old, new)
+}
+
+// syncDir do nothing, directories cannot be flushed on windows.
+func syncDir(dir string) error {
+	return nil
+}
+
+// dropPageCache do nothing, page cache of a file cannot be dropped on windows.
+func dropPageCache(path string) error {
+	return nil
+}
@@ -0,0 +1,167 @@
+package acp
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	defaultTapeBlockSize = 256 * 1024
+	tarBlockSize         = 512
+)
+
+type tapeOption struct {
+	blockSize   int
+	archiveSize int64
+	fileNumber  int
+}
+
+type TapeOption func(*tapeOption) *tapeOption
+
+// TapeBlockSize sets the fixed block size of tape, each write to the drive is one block.
+// It should be a multiple of 512, default is 256KB.
+func TapeBlockSize(size int) TapeOption {
+	return func(o *tapeOption) *tapeOption {
+		o.blockSize = size
+		return o
+	}
+}
+
+// TapeArchiveSize starts a new archive after a filemark, when the archive is larger than size.
+// Members are never split, and hard links may point to members of previous archives. Zero means one archive.
+func TapeArchiveSize(size int64) TapeOption {
+	return func(o *tapeOption) *tapeOption {
+		o.archiveSize = size
+		return o
+	}
+}
+
+// TapeFileNumber sets the file number of the first archive, default is the current file number
+// of the drive, or zero if target is not a tape drive.
+func TapeFileNumber(n int) TapeOption {
+	return func(o *tapeOption) *tapeOption {
+		o.fileNumber = n
+		return o
+	}
+}
+
+// WithTapeTarget writes all jobs into a tape drive like '/dev/nst0' as pax archives in fixed size blocks,
+// see `WithTarTarget`. Each archive is ended by a filemark, so use a non-rewinding device to append archives.
+// File number and block of each member is reported in `Job.Archive`, which can be used to seek on restore.
+// Regular files and pipes can be used as target too, with archives padded to blocks and no filemark.
+func WithTapeTarget(device string, opts ...TapeOption) Option {
+	return func(o *option) *option {
+		tape := &tapeOption{blockSize: defaultTapeBlockSize, fileNumber: -1}
+		for _, opt := range opts {
+			if opt == nil {
+				continue
+			}
+			tape = opt(tape)
+		}
+
+		o.archive = &archiveTarget{name: device, path: device, tape: tape}
+		return o
+	}
+}
+
+func (o *tapeOption) check() error {
+	if o.blockSize <= 0 || o.blockSize%tarBlockSize != 0 {
+		return fmt.Errorf("tape block size should be a multiple of %d, have= %d", tarBlockSize, o.blockSize)
+	}
+	if o.archiveSize < 0 {
+		return fmt.Errorf("unexpected tape archive size, %d", o.archiveSize)
+	}
+	return nil
+}
+
+// tapeWriter writes data to the drive in fixed size blocks.
+type tapeWriter struct {
+	file  *os.File
+	drive bool // file is a tape drive, filemarks can be written
+	buf   []byte
+}
+
+func openTapeWriter(path string, opt *tapeOption) (*tapeWriter, error) {
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	stat, err := os.Stat(path)
+	drive := err == nil && stat.Mode()&os.ModeCharDevice != 0
+	if err == nil && !stat.Mode().IsRegular() {
+		flag = os.O_WRONLY
+	}
+
+	file, err := os.OpenFile(path, flag, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open tape fail, path= '%s', %w", path, err)
+	}
+
+	fileNumber := 0
+	if drive {
+		if fileNumber, err = setupTapeDrive(file, opt.blockSize); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("setup tape drive fail, path= '%s', %w", path, err)
+		}
+	}
+	if opt.fileNumber < 0 {
+		opt.fileNumber = fileNumber
+	}
+
+	return &tapeWriter{file: file, drive: drive, buf: make([]byte, 0, opt.blockSize)}, nil
+}
+
+func (w *tapeWriter) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		n := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf, p, written = w.buf[:len(w.buf)+n], p[n:], written+n
+
+		if len(w.buf) == cap(w.buf) {
+			if err := w.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (w *tapeWriter) flush() error {
+	defer func() { w.buf = w.buf[:0] }()
+
+	n, err := w.file.Write(w.buf)
+	if err != nil {
+		return err
+	}
+	if n != len(w.buf) {
+		return io.ErrShortWrite
+	}
+	return nil
+}
+
+// filemark pads the last block with zeros, and ends the tape file.
+func (w *tapeWriter) filemark() error {
+	if len(w.buf) > 0 {
+		n := len(w.buf)
+		w.buf = w.buf[:cap(w.buf)]
+		for idx := n; idx < len(w.buf); idx++ {
+			w.buf[idx] = 0
+		}
+		if err := w.flush(); err != nil {
+			return fmt.Errorf("write last block fail, %w", err)
+		}
+	}
+	if !w.drive {
+		return nil
+	}
+	if err := writeFilemark(w.file); err != nil {
+		return fmt.Errorf("write filemark fail, %w", err)
+	}
+	return nil
+}
+
+func (w *tapeWriter) Close() error {
+	err := w.filemark()
+	if cerr := w.file.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,62 @@
+//go:build linux
+// +build linux
+
+package acp
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// operations of st driver, from linux/mtio.h
+const (
+	mtWEOF   = 5
+	mtSETBLK = 20
+)
+
+type mtop struct {
+	op    int16
+	count int32
+}
+
+type mtget struct {
+	typ    int
+	resid  int
+	dsreg  int
+	gstat  int
+	erreg  int
+	fileno int32
+	blkno  int32
+}
+
+// ioctl numbers in asm-generic layout
+var (
+	mtIOCTOP = 1<<30 | unsafe.Sizeof(mtop{})<<16 | 'm'<<8 | 1
+	mtIOCGET = 2<<30 | unsafe.Sizeof(mtget{})<<16 | 'm'<<8 | 2
+)
+
+func tapeOp(file *os.File, op int16, count int32) error {
+	arg := mtop{op: op, count: count}
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, file.Fd(), mtIOCTOP, uintptr(unsafe.Pointer(&arg))); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// setupTapeDrive sets the fixed block size of drive, and returns the current file number.
+func setupTapeDrive(file *os.File, blockSize int) (int, error) {
+	var status mtget
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, file.Fd(), mtIOCGET, uintptr(unsafe.Pointer(&status))); errno != 0 {
+		return 0, errno
+	}
+	if err := tapeOp(file, mtSETBLK, int32(blockSize)); err != nil {
+		return 0, err
+	}
+	return int(status.fileno), nil
+}
+
+func writeFilemark(file *os.File) error {
+	return tapeOp(file, mtWEOF, 1)
+}
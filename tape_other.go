@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package acp
+
+import (
+	"fmt"
+	"os"
+)
+
+func setupTapeDrive(file *os.File, blockSize int) (int, error) {
+	return 0, fmt.Errorf("tape drive is only supported on linux")
+}
+
+func writeFilemark(file *os.File) error {
+	return fmt.Errorf("tape drive is only supported on linux")
+}
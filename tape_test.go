@@ -0,0 +1,125 @@
+package acp
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+func TestTapeTarget(t *testing.T) {
+	const blockSize = 1024
+
+	root := t.TempDir()
+	src, tape := filepath.Join(root, "src"), filepath.Join(root, "tape")
+	files := map[string]string{
+		"a/1.txt": strings.Repeat("1", 3000),
+		"a/2.txt": "2",
+		"b/3.txt": strings.Repeat("3", 5000),
+		"b/4.txt": "",
+		"c/5.txt": strings.Repeat("5", 700),
+	}
+	for name, content := range files {
+		writeTestFile(t, filepath.Join(src, name), content)
+	}
+
+	report := runCopyer(t, WildcardJob(Source(src)),
+		WithTapeTarget(tape, TapeBlockSize(blockSize), TapeArchiveSize(4096), TapeFileNumber(3)))
+	if len(report.Errors) > 0 {
+		t.Fatalf("unexpected errors: %v", report.Errors[0])
+	}
+
+	data, err := os.ReadFile(tape)
+	if err != nil || len(data)%blockSize != 0 {
+		t.Fatalf("unexpected tape, len= %d, err= %v", len(data), err)
+	}
+
+	// archives are padded to blocks, a regular file has no filemark
+	starts := make([]int64, 0)
+	for start := int64(0); start < int64(len(data)); {
+		starts = append(starts, start)
+
+		r := &countReader{r: bytes.NewReader(data[start:])}
+		tr := tar.NewReader(r)
+		for {
+			_, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("read archive at %d: %v", start, err)
+			}
+		}
+		start += (r.n + blockSize - 1) / blockSize * blockSize
+	}
+	if len(starts) < 2 {
+		t.Fatalf("archive is not split, starts= %v", starts)
+	}
+
+	for name, content := range files {
+		job := findReportJob(report, filepath.Join("src", name))
+		if job == nil || job.Archive == nil {
+			t.Fatalf("unexpected job %s: %+v", name, job)
+		}
+
+		member := job.Archive
+		if member.File < 3 || member.File-3 >= len(starts) || member.Block != member.Offset/blockSize {
+			t.Fatalf("unexpected member %s: %+v", name, member)
+		}
+		pos := starts[member.File-3] + member.Block*blockSize + member.Offset%blockSize
+
+		tr := tar.NewReader(bytes.NewReader(data[pos:]))
+		hdr, err := tr.Next()
+		if err != nil || hdr.Name != member.Name {
+			t.Fatalf("read member %s at %d: %v, %v", name, pos, hdr, err)
+		}
+		got, err := io.ReadAll(tr)
+		if err != nil || string(got) != content {
+			t.Fatalf("unexpected content of %s: len= %d, err= %v", name, len(got), err)
+		}
+	}
+}
+
+func TestTapeWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tape")
+	w, err := openTapeWriter(path, &tapeOption{blockSize: 512, fileNumber: -1})
+	if err != nil {
+		t.Fatalf("open tape writer: %v", err)
+	}
+
+	if _, err := w.Write(bytes.Repeat([]byte{'a'}, 700)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.filemark(); err != nil {
+		t.Fatalf("filemark: %v", err)
+	}
+	if _, err := w.Write([]byte{'b'}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil || len(data) != 1536 || data[699] != 'a' || data[700] != 0 || data[1024] != 'b' || data[1025] != 0 {
+		t.Fatalf("unexpected tape, len= %d, err= %v", len(data), err)
+	}
+
+	if err := (&tapeOption{blockSize: 1000}).check(); err == nil {
+		t.Fatalf("block size which is not a multiple of 512 should fail")
+	}
+}
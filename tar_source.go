@@ -0,0 +1,191 @@
+package acp
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type tarSource struct {
+	name   string
+	path   string
+	reader io.Reader
+}
+
+// TarSource read members of a tar (or pax) archive file as sources, members are copied to
+// `target/<member name>`. The archive is read only once, in order, while copying.
+// Filters match member names, the same as paths relative to the root of dir source.
+// It cannot be used with `WithDelete`.
+func TarSource(path string) WildcardJobOption {
+	return func(j *wildcardJob) *wildcardJob {
+		j.tars = append(j.tars, &tarSource{name: path, path: path})
+		return j
+	}
+}
+
+// TarSourceReader read members of a tar stream as sources, such like stdin, see `TarSource`.
+// Name is used as the base of sources in report.
+func TarSourceReader(name string, r io.Reader) WildcardJobOption {
+	return func(j *wildcardJob) *wildcardJob {
+		j.tars = append(j.tars, &tarSource{name: name, reader: r})
+		return j
+	}
+}
+
+func (t *tarSource) check() error {
+	if t.reader != nil {
+		return nil
+	}
+	if _, err := os.Stat(t.path); err != nil {
+		return fmt.Errorf("check tar source '%s', %w", t.path, err)
+	}
+	return nil
+}
+
+// tarStream is the data reader of a tar member, it is closed after the data is written,
+// then the next member can be read.
+type tarStream struct {
+	reader io.Reader
+	done   chan struct{}
+	once   sync.Once
+}
+
+func newTarStream(r io.Reader) *tarStream {
+	return &tarStream{reader: r, done: make(chan struct{})}
+}
+
+func (s *tarStream) Read(p []byte) (int, error) {
+	return s.reader.Read(p)
+}
+
+func (s *tarStream) Close() error {
+	s.once.Do(func() { close(s.done) })
+	return nil
+}
+
+// tarMemberName cleans the member name, members can not be extracted out of the target.
+func tarMemberName(name string) (string, bool) {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	return name, name != ""
+}
+
+func newTarStat(hdr *tar.Header) *stat {
+	st := &stat{
+		size:    hdr.Size,
+		mode:    hdr.FileInfo().Mode(),
+		modTime: hdr.ModTime,
+		sys:     newTarSysStat(hdr),
+	}
+	if hdr.Typeflag == tar.TypeSymlink {
+		st.link = hdr.Linkname
+	}
+	return st
+}
+
+// indexTar reads members of the tar source and sends them as jobs. Before reading the next member,
+// it waits for the data of current member to be written.
+func (c *Copyer) indexTar(ctx context.Context, job *wildcardJob, src *tarSource, ch chan<- *baseJob, cntr *counter) error {
+	reader := src.reader
+	if reader == nil {
+		file, err := os.Open(src.path)
+		if err != nil {
+			return fmt.Errorf("open tar source fail, %w", err)
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	lastCount := time.Now()
+	submitCount := func(finished bool) {
+		c.submit(&EventUpdateCount{
+			Bytes:    atomic.LoadInt64(&cntr.bytes),
+			Files:    atomic.LoadInt64(&cntr.files),
+			Skipped:  atomic.LoadInt64(&cntr.skipped),
+			Finished: finished,
+		})
+		lastCount = time.Now()
+	}
+	defer submitCount(true)
+
+	members := make(map[string]*baseJob, 64)
+	tr := tar.NewReader(reader)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read tar header fail, %w", err)
+		}
+
+		name, ok := tarMemberName(hdr.Name)
+		if !ok {
+			continue
+		}
+
+		s := &source{base: src.name, path: name}
+		if keep, _ := job.filter.match(name, hdr.FileInfo(), false); !keep {
+			atomic.AddInt64(&cntr.skipped, 1)
+			continue
+		}
+
+		targets := make([]string, 0, len(job.dst))
+		for _, d := range job.dst {
+			targets = append(targets, s.dst(d))
+		}
+
+		st := newTarStat(hdr)
+		if st.mode.IsDir() {
+			dirTargets := append(append([]string(nil), targets...), job.span.targets(s)...)
+			c.dirs = append(c.dirs, &dirJob{src: s, path: s.src(), stat: st, targets: dirTargets})
+			if !c.emptyDirs {
+				continue
+			}
+		}
+
+		bj := &baseJob{copyer: c, src: s, path: s.src(), stat: st, targets: targets, span: job.span}
+		switch {
+		case hdr.Typeflag == tar.TypeLink:
+			linkname, _ := tarMemberName(hdr.Linkname)
+			primary, has := members[linkname]
+			if !has {
+				c.reportError(bj.path, "", fmt.Errorf("hard link source is not found in tar, '%s'", hdr.Linkname))
+				continue
+			}
+			bj.linkTo, st.size = primary, primary.stat.size
+		case st.mode.IsRegular():
+			bj.stream = newTarStream(tr)
+		}
+
+		members[name] = bj
+		if !c.admitJob(bj, cntr) {
+			continue
+		}
+		if time.Since(lastCount) >= time.Second {
+			submitCount(false)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ch <- bj:
+		}
+		if bj.stream == nil || c.dryRun {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-bj.stream.done:
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package acp
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTarSource(t *testing.T) {
+	root := t.TempDir()
+	dst1, dst2 := filepath.Join(root, "dst1"), filepath.Join(root, "dst2")
+	mkdirTest(t, dst1, dst2)
+
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	for _, m := range []struct {
+		hdr  *tar.Header
+		data string
+	}{
+		{&tar.Header{Typeflag: tar.TypeDir, Name: "data/", Mode: 0o755, ModTime: mtime}, ""},
+		{&tar.Header{Typeflag: tar.TypeReg, Name: "data/a.txt", Mode: 0o644, ModTime: mtime, Size: 4}, "aaaa"},
+		{&tar.Header{Typeflag: tar.TypeReg, Name: "data/sub/big.bin", Mode: 0o600, ModTime: mtime, Size: 3 * batchSize}, string(bytes.Repeat([]byte{'b'}, 3*batchSize))},
+		{&tar.Header{Typeflag: tar.TypeReg, Name: "../escape.txt", Mode: 0o644, ModTime: mtime, Size: 1}, "e"},
+		{&tar.Header{Typeflag: tar.TypeReg, Name: "data/empty.txt", Mode: 0o644, ModTime: mtime}, ""},
+		{&tar.Header{Typeflag: tar.TypeLink, Name: "data/link.txt", Linkname: "data/a.txt", ModTime: mtime}, ""},
+	} {
+		if err := tw.WriteHeader(m.hdr); err != nil {
+			t.Fatalf("write header: %v", err)
+		}
+		if _, err := tw.Write([]byte(m.data)); err != nil {
+			t.Fatalf("write data: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("close tar: %v", err)
+	}
+
+	report := runCopyer(t, WildcardJob(TarSourceReader("backup.tar", buf), Target(dst1, dst2)), WithHash(true), WithHardLinks(true))
+	if len(report.Errors) > 0 {
+		t.Fatalf("unexpected errors: %v", report.Errors[0])
+	}
+
+	for _, dst := range []string{dst1, dst2} {
+		for name, want := range map[string]int{"data/a.txt": 4, "data/sub/big.bin": 3 * batchSize, "escape.txt": 1, "data/empty.txt": 0, "data/link.txt": 4} {
+			fi, err := os.Stat(filepath.Join(dst, name))
+			if err != nil || fi.Size() != int64(want) {
+				t.Fatalf("unexpected target %s: %v, %v", name, fi, err)
+			}
+			if !fi.ModTime().Equal(mtime) {
+				t.Fatalf("unexpected mtime of %s: %s", name, fi.ModTime())
+			}
+		}
+
+		a, _ := os.Stat(filepath.Join(dst, "data/a.txt"))
+		link, _ := os.Stat(filepath.Join(dst, "data/link.txt"))
+		if !os.SameFile(a, link) {
+			t.Fatalf("hard link is not kept")
+		}
+	}
+
+	job := findReportJob(report, "data/sub/big.bin")
+	if job == nil || job.FullPath != "backup.tar/data/sub/big.bin" || len(job.SuccessTargets) != 2 || job.SHA256 == "" {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+}
+
+func TestTarSourceFilter(t *testing.T) {
+	dst := t.TempDir()
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	for _, name := range []string{"a.txt", "sub/a.txt", "b.tmp"} {
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0o644, Size: 4}); err != nil {
+			t.Fatalf("write header: %v", err)
+		}
+		if _, err := tw.Write([]byte("aaaa")); err != nil {
+			t.Fatalf("write data: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("close tar: %v", err)
+	}
+
+	// member names are matched as paths relative to the root of dir source
+	report := runCopyer(t, WildcardJob(TarSourceReader("backup.tar", buf), Target(dst), Exclude("/a.txt", "*.tmp")))
+	if len(report.Jobs) != 1 || findReportJob(report, "sub/a.txt") == nil {
+		t.Fatalf("unexpected jobs, %+v", report.Jobs)
+	}
+}
+
+func TestTarSourceDelete(t *testing.T) {
+	for _, opt := range []Option{WithDelete(true), WithDeleteDryRun(true)} {
+		o := newOption()
+		o = WildcardJob(TarSourceReader("backup.tar", new(bytes.Buffer)), Target(t.TempDir()))(o)
+		o = opt(o)
+		if err := o.check(); err == nil {
+			t.Fatalf("delete with tar source is accepted")
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package acp
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+)
+
+type UpdateMode uint8
+
+const (
+	// UpdateSizeMtime skip targets which have the same size and mtime as source
+	UpdateSizeMtime = UpdateMode(iota + 1)
+	// UpdateChecksum skip targets which have the same size and hash as source, sources are read once
+	// more while indexing, so it cannot be used with linear from device
+	UpdateChecksum
+	// UpdateAlways rewrite all targets
+	UpdateAlways
+	// UpdateNever skip all exist targets, only copy missing files
+	UpdateNever
+)
+
+var updateModeNames = map[string]UpdateMode{
+	"size-mtime": UpdateSizeMtime,
+	"checksum":   UpdateChecksum,
+	"always":     UpdateAlways,
+	"never":      UpdateNever,
+}
+
+// ParseUpdateMode parses update mode from name, can be 'size-mtime', 'checksum', 'always' or 'never'.
+func ParseUpdateMode(name string) (UpdateMode, error) {
+	mode, has := updateModeNames[name]
+	if !has {
+		return 0, fmt.Errorf("unexpected update mode, '%s'", name)
+	}
+	return mode, nil
+}
+
+// UpdatePolicy compare exist targets with source, unchanged targets are skipped and changed
+// targets are rewritten, like rsync. It overrides `Overwrite`.
+func UpdatePolicy(mode UpdateMode) Option {
+	return func(o *option) *option {
+		o.updateMode = mode
+		return o
+	}
+}
+
+// checkUpdate moves unchanged targets from `targets` to `skipTargets`.
+func (c *Copyer) checkUpdate(job *baseJob) {
+	if c.updateMode == 0 || c.updateMode == UpdateAlways {
+		return
+	}
+
+	var srcHashes map[string][]byte
+	var srcErr error
+	targets := make([]string, 0, len(job.targets))
+	for _, target := range job.targets {
+		fi, err := os.Lstat(target)
+		if err != nil {
+			targets = append(targets, target)
+			continue
+		}
+
+		unchanged := false
+		switch {
+		case c.updateMode == UpdateNever:
+			unchanged = true
+		case !job.stat.mode.IsRegular() || !fi.Mode().IsRegular() || fi.Size() != job.stat.size:
+		case c.updateMode == UpdateSizeMtime || job.stream != nil:
+			// tar members can not be hashed before copying
+			unchanged = fi.ModTime().Equal(job.stat.modTime)
+		case c.updateMode == UpdateChecksum:
+			if srcHashes == nil && srcErr == nil {
+				srcHashes, srcErr = hashFile(job.path, c.fromDevice.linear, c.updateHashes()...)
+				if srcErr != nil {
+					c.reportError(job.path, "", fmt.Errorf("update hash src file fail, %w", srcErr))
+				}
+			}
+			if srcErr != nil {
+				break
+			}
+
+			unchanged = c.compareTargetHash(job, target, srcHashes)
+		}
+		if !unchanged {
+			targets = append(targets, target)
+			continue
+		}
+
+		job.skipTargets = append(job.skipTargets, target)
+	}
+	job.targets = targets
+
+	if len(targets) == 0 && srcHashes != nil && c.withHash {
+		job.hashes = srcHashes
+	}
+}
+
+func (c *Copyer) updateHashes() []string {
+	if len(c.hashes) > 0 {
+		return c.hashes
+	}
+	return []string{HashSHA256}
+}
+
+func (c *Copyer) compareTargetHash(job *baseJob, target string, want map[string][]byte) bool {
+	got, err := hashFile(target, c.linearTarget(target), c.updateHashes()...)
+	if err != nil {
+		c.reportError(job.path, target, fmt.Errorf("update hash dst file fail, %w", err))
+		return false
+	}
+
+	for name, h := range want {
+		if !bytes.Equal(got[name], h) {
+			return false
+		}
+	}
+	return true
+}
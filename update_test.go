@@ -0,0 +1,147 @@
+package acp
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUpdatePolicy(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "src"), filepath.Join(root, "dst")
+	writeTestFile(t, filepath.Join(src, "same.txt"), "same")
+	writeTestFile(t, filepath.Join(src, "changed.txt"), "old1")
+	writeTestFile(t, filepath.Join(src, "touched.txt"), "tttt")
+	mkdirTest(t, dst)
+	runCopyer(t, WildcardJob(Source(src), Target(dst)))
+
+	// same size, content and mtime are changed
+	writeTestFile(t, filepath.Join(src, "changed.txt"), "new1")
+	mtime := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(src, "changed.txt"), mtime, mtime); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	// only mtime is changed
+	if err := os.Chtimes(filepath.Join(src, "touched.txt"), mtime, mtime); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+
+	cases := []struct {
+		mode    UpdateMode
+		skipped map[string]bool
+	}{
+		{UpdateNever, map[string]bool{"same.txt": true, "changed.txt": true, "touched.txt": true}},
+		{UpdateChecksum, map[string]bool{"same.txt": true, "changed.txt": false, "touched.txt": true}},
+		{UpdateSizeMtime, map[string]bool{"same.txt": true, "changed.txt": true, "touched.txt": false}},
+		{UpdateAlways, map[string]bool{"same.txt": false, "changed.txt": false, "touched.txt": false}},
+	}
+	for _, tc := range cases {
+		report := runCopyer(t, WildcardJob(Source(src), Target(dst)), UpdatePolicy(tc.mode))
+		if len(report.Errors) > 0 {
+			t.Fatalf("mode %d: unexpected errors: %v", tc.mode, report.Errors[0])
+		}
+
+		for name, skipped := range tc.skipped {
+			job := findReportJob(report, "src/"+name)
+			if job == nil {
+				t.Fatalf("mode %d: job %s not found", tc.mode, name)
+			}
+			if skipped && (job.Status != JobStatusSkipped || len(job.SkipTargets) != 1) {
+				t.Fatalf("mode %d: %s should be skipped: %+v", tc.mode, name, job)
+			}
+			if !skipped && (job.Status != JobStatusFinished || len(job.SuccessTargets) != 1) {
+				t.Fatalf("mode %d: %s should be copied: %+v", tc.mode, name, job)
+			}
+		}
+	}
+
+	got, err := os.ReadFile(filepath.Join(dst, "src", "changed.txt"))
+	if err != nil || string(got) != "new1" {
+		t.Fatalf("changed file is not updated: %q, %v", got, err)
+	}
+}
+
+func TestUpdateHardLinkToSkipped(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "src"), filepath.Join(root, "dst")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "aaaa")
+	if err := os.Link(filepath.Join(src, "a.txt"), filepath.Join(src, "b.txt")); err != nil {
+		t.Fatalf("link: %v", err)
+	}
+	mkdirTest(t, dst)
+	runCopyer(t, WildcardJob(Source(src), Target(dst)), WithHardLinks(true))
+	if err := os.Remove(filepath.Join(dst, "src", "b.txt")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+
+	report := runCopyer(t, WildcardJob(Source(src), Target(dst)), WithHardLinks(true), UpdatePolicy(UpdateSizeMtime))
+	if len(report.Errors) > 0 {
+		t.Fatalf("unexpected errors: %v", report.Errors[0])
+	}
+	if job := findReportJob(report, "src/a.txt"); job == nil || job.Status != JobStatusSkipped {
+		t.Fatalf("primary should be skipped: %+v", job)
+	}
+	if job := findReportJob(report, "src/b.txt"); job == nil || job.HardLinkTo != filepath.Join(src, "a.txt") || len(job.SuccessTargets) != 1 {
+		t.Fatalf("unexpected linked job: %+v", job)
+	}
+
+	a, _ := os.Stat(filepath.Join(dst, "src", "a.txt"))
+	b, _ := os.Stat(filepath.Join(dst, "src", "b.txt"))
+	if a == nil || b == nil || !os.SameFile(a, b) {
+		t.Fatalf("hard link is not kept")
+	}
+}
+
+func TestUpdateTarHardLinkToSkipped(t *testing.T) {
+	dst := t.TempDir()
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "a.txt", Mode: 0o644, ModTime: mtime, Size: 4}); err != nil {
+		t.Fatalf("write header: %v", err)
+	}
+	if _, err := tw.Write([]byte("aaaa")); err != nil {
+		t.Fatalf("write data: %v", err)
+	}
+	if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeLink, Name: "b.txt", Linkname: "a.txt", ModTime: mtime}); err != nil {
+		t.Fatalf("write header: %v", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("close tar: %v", err)
+	}
+
+	writeTestFile(t, filepath.Join(dst, "a.txt"), "aaaa")
+	if err := os.Chtimes(filepath.Join(dst, "a.txt"), mtime, mtime); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+
+	report := runCopyer(t, WildcardJob(TarSourceReader("backup.tar", buf), Target(dst)), WithHardLinks(true), UpdatePolicy(UpdateSizeMtime))
+	if len(report.Errors) > 0 {
+		t.Fatalf("unexpected errors: %v", report.Errors[0])
+	}
+	if job := findReportJob(report, "b.txt"); job == nil || len(job.SuccessTargets) != 1 {
+		t.Fatalf("unexpected linked job: %+v", job)
+	}
+
+	a, _ := os.Stat(filepath.Join(dst, "a.txt"))
+	b, _ := os.Stat(filepath.Join(dst, "b.txt"))
+	if a == nil || b == nil || !os.SameFile(a, b) {
+		t.Fatalf("hard link is not kept")
+	}
+}
+
+func TestUpdateChecksumLinearSource(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "src", "a.txt"), "aaaa")
+
+	opt := newOption()
+	opt = WildcardJob(Source(filepath.Join(root, "src")), Target(root))(opt)
+	opt = SetFromDevice(LinearDevice(true))(opt)
+	opt = UpdatePolicy(UpdateChecksum)(opt)
+	if err := opt.check(); err == nil {
+		t.Fatalf("checksum update with linear source is accepted")
+	}
+}
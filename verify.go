@@ -0,0 +1,110 @@
+package acp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrVerifyMismatch = fmt.Errorf("acp: verify target hash mismatch")
+	ErrVerifyMissing  = fmt.Errorf("acp: verify target missing")
+	ErrVerifyExtra    = fmt.Errorf("acp: verify target not expected")
+)
+
+// WithVerify re-read every success target after copy, and compare its hash with the source.
+// Targets are read from disk instead of page cache on linux.
+// Mismatched targets will be moved into `FailTargets` with `ErrVerifyMismatch`.
+func WithVerify(b bool) Option {
+	return func(o *option) *option {
+		o.withVerify = b
+		return o
+	}
+}
+
+func (c *Copyer) verify(ctx context.Context, copyed <-chan *baseJob) <-chan *baseJob {
+	if !c.withVerify {
+		return copyed
+	}
+
+	var wg sync.WaitGroup
+	ch := make(chan *baseJob, 128)
+	defer func() {
+		go wrap(ctx, func() {
+			defer close(ch)
+			wg.Wait()
+		})
+	}()
+
+	for idx := 0; idx < c.toDevice.threads; idx++ {
+		wg.Add(1)
+		go wrap(ctx, func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job, ok := <-copyed:
+					if !ok {
+						return
+					}
+
+					c.verifyJob(ctx, job)
+					ch <- job
+				}
+			}
+		})
+	}
+
+	return ch
+}
+
+func (c *Copyer) verifyJob(ctx context.Context, job *baseJob) {
+	job.lock.Lock()
+	want := make(map[string][]byte, len(job.hashes))
+	for name, h := range job.hashes {
+		want[name] = h
+	}
+	targets := append([]string(nil), job.successTargets...)
+	job.lock.Unlock()
+
+	if len(want) == 0 || len(targets) == 0 {
+		return
+	}
+
+	job.setStatus(jobStatusVerifying)
+	for _, target := range targets {
+		if ctx.Err() != nil {
+			return
+		}
+
+		got, err := c.hashTarget(job.writePath(target))
+		if err != nil {
+			job.revoke(target, fmt.Errorf("verify read dst file fail, %w", mappingError(err)))
+			continue
+		}
+
+		for _, name := range c.hashes {
+			w, has := want[name]
+			if !has {
+				continue
+			}
+			if !bytes.Equal(got[name], w) {
+				job.revoke(target, fmt.Errorf("%w, hash= %s want= %x got= %x", ErrVerifyMismatch, name, w, got[name]))
+				break
+			}
+		}
+	}
+}
+
+func (c *Copyer) hashTarget(target string) (map[string][]byte, error) {
+	// target should be read from disk, or the written data in page cache is verified
+	if err := dropPageCache(target); err != nil {
+		c.logf(logrus.DebugLevel, "drop page cache fail, path= '%s', %s", target, err)
+	}
+	return hashFile(target, c.linearTarget(target), c.hashes...)
+}
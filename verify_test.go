@@ -0,0 +1,65 @@
+package acp
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "src"), filepath.Join(root, "dst")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "aaaa")
+	mkdirTest(t, dst)
+
+	report := runCopyer(t, WildcardJob(Source(src), Target(dst)), WithVerify(true))
+	job := findReportJob(report, "src/a.txt")
+	if job == nil || job.Status != JobStatusFinished || len(job.SuccessTargets) != 1 || job.SHA256 == "" {
+		t.Fatalf("unexpected verified job: %+v", job)
+	}
+}
+
+func TestVerifyMismatch(t *testing.T) {
+	root := t.TempDir()
+	target := filepath.Join(root, "a.txt")
+	writeTestFile(t, target, "corrupted")
+
+	opt := newOption()
+	opt.withVerify = true
+	if err := opt.check(); err != nil {
+		t.Fatalf("check option: %v", err)
+	}
+
+	c := &Copyer{option: opt, eventCh: make(chan Event, 128)}
+	job := &baseJob{
+		copyer:         c,
+		src:            &source{base: root, path: "a.txt"},
+		path:           target,
+		stat:           &stat{},
+		targets:        []string{target},
+		successTargets: []string{target},
+		hashes:         map[string][]byte{HashSHA256: {0x01, 0x02}},
+	}
+
+	c.verifyJob(context.Background(), job)
+	if len(job.successTargets) != 0 {
+		t.Fatalf("mismatched target still success, %v", job.successTargets)
+	}
+	if err := job.failedTargets[target]; !errors.Is(err, ErrVerifyMismatch) {
+		t.Fatalf("unexpected verify error, %v", err)
+	}
+}
+
+func TestVerifyDropPageCache(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "a.txt")
+	writeTestFile(t, target, "aaaa")
+
+	if err := dropPageCache(target); err != nil {
+		t.Fatalf("drop page cache: %v", err)
+	}
+	if got, err := os.ReadFile(target); err != nil || string(got) != "aaaa" {
+		t.Fatalf("unexpected target after dropping page cache: %q, %v", got, err)
+	}
+}